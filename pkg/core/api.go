@@ -15,15 +15,18 @@
 package core
 
 import (
-	"fmt"
+	"errors"
 	"strconv"
 
 	"github.com/douyu/juno-agent/pkg/file"
 	"github.com/douyu/juno-agent/pkg/model"
 	"github.com/douyu/juno-agent/pkg/pmt"
+	"github.com/douyu/juno-agent/pkg/proto/configpb"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/audit"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/validator"
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/douyu/juno-agent/util"
-	"github.com/douyu/jupiter/pkg/conf"
 	"github.com/douyu/jupiter/pkg/server/xecho"
 	"github.com/douyu/jupiter/pkg/server/xgrpc"
 	"github.com/labstack/echo/v4"
@@ -31,6 +34,11 @@ import (
 	"google.golang.org/grpc/examples/helloworld/helloworld"
 )
 
+const headerConfigStale = "X-Juno-Config-Stale"
+
+// headerConfigScope the scope of the config returned: hostname/zone:<code>/region:<code>/cluster
+const headerConfigScope = "X-Juno-Config-Scope"
+
 func (eng *Engine) serveHTTP() error {
 
 	s := xecho.StdConfig("http").MustBuild()
@@ -38,7 +46,9 @@ func (eng *Engine) serveHTTP() error {
 	group := s.Group("/api")
 	group.GET("/config/:target", eng.getAppConfigContent)
 	group.GET("/agent/reload", eng.agentReload)           // restart confd monitoring
+	group.GET("/agent/reload/status", eng.reloadStatus)   // confd monitoring status
 	group.GET("/agent/process/status", eng.processStatus) // real time process status
+	group.GET("/agent/plugins", eng.pluginStatus)         // plugin running and health status
 	group.POST("/agent/process/shell", eng.pmtShell)
 	group.GET("/agent/file", eng.readFile) // 文件读取
 
@@ -50,6 +60,13 @@ func (eng *Engine) serveHTTP() error {
 
 	v1Group.GET("/agent/rawKey/getConfig", eng.getRawAppConfig)       // 根据原生key获取配置信息
 	v1Group.GET("/agent/rawKey/listenConfig", eng.listenRawKeyConfig) // 根据原生key长轮训监听配置
+	v1Group.GET("/agent/config/versions", eng.configVersions)         // 配置文件历史版本
+	v1Group.POST("/agent/config/rollback", eng.configRollback)        // 配置文件回滚
+	v1Group.GET("/agent/config/stream", eng.streamConfig)             // SSE推送配置变化
+	v1Group.GET("/agent/config/bundle", eng.getConfigBundle)          // 应用的全部配置文件
+	v1Group.GET("/agent/config/drift", eng.configDrift)               // 被手动修改或删除的配置文件
+	v1Group.GET("/agent/config/history", eng.configHistory)           // 配置下发审计记录
+	v1Group.GET("/agent/cronjob/log", eng.cronTaskLog)                // 定时任务的本地日志
 
 	return eng.Serve(s)
 }
@@ -61,18 +78,40 @@ func (eng *Engine) serveGRPC() error {
 	pb.RegisterWatchServer(server.Server, eng.regProxy)
 	pb.RegisterLeaseServer(server.Server, eng.regProxy)
 	helloworld.RegisterGreeterServer(server.Server, eng.regProxy)
+	if eng.confProxy != nil {
+		configpb.RegisterConfigServiceServer(server.Server, confProxy.NewConfigServer(eng.confProxy))
+	}
 
 	return eng.Serve(server)
 }
 
+// errConfProxyDisabled confProxy 未开启时, 配置相关的接口返回的错误
+const errConfProxyDisabled = "confProxy is not enabled"
+
 // agentReload reload agent watch
 func (eng *Engine) agentReload(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
 	if err := eng.confProxy.Reload(); err != nil {
 		return reply400(ctx, "reload err "+err.Error())
 	}
 	return reply200(ctx, nil)
 }
 
+// reloadStatus show the watch revision, watch health and the result of the last reload
+func (eng *Engine) reloadStatus(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
+	return reply200(ctx, eng.confProxy.ReloadStatus())
+}
+
+// pluginStatus show whether each plugin is enabled, running and healthy
+func (eng *Engine) pluginStatus(ctx echo.Context) error {
+	return reply200(ctx, eng.registry.Health())
+}
+
 type confStatusBind struct {
 	Config string `json:"config"` //path to profile
 }
@@ -97,11 +136,15 @@ func (eng *Engine) confStatus(ctx echo.Context) error {
 // if the config change in internal time(default 60s),return the changed config
 // other return the status 400
 func (eng *Engine) listenConfig(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
 	var defaultListenInternal = 60
 	appName := ctx.QueryParam("name")
 	appEnv := ctx.QueryParam("env")
 	target := ctx.QueryParam("target")
 	port := ctx.QueryParam("port")
+	version := ctx.QueryParam("version")
 	enableWatch, _ := strconv.ParseBool(ctx.QueryParam("watch"))
 	listenInternal, _ := strconv.Atoi(ctx.QueryParam("internal"))
 	if listenInternal > 0 {
@@ -111,7 +154,7 @@ func (eng *Engine) listenConfig(ctx echo.Context) error {
 		config structs.ContentNode
 		err    error
 	)
-	if config, err = eng.confProxy.ListenAppConfig(ctx, appName, appEnv, target, port, enableWatch, defaultListenInternal); err != nil {
+	if config, err = eng.confProxy.ListenAppConfig(ctx, appName, appEnv, target, port, enableWatch, defaultListenInternal, version); err != nil {
 		return reply400(ctx, "no data change")
 	}
 	return reply200(ctx, config)
@@ -121,11 +164,15 @@ func (eng *Engine) listenConfig(ctx echo.Context) error {
 // if the config change in internal time(default 60s),return the changed config
 // other return the status 400
 func (eng *Engine) listenRawKeyConfig(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
 	var defaultListenInternal = 60
 	rawKey := ctx.QueryParam("rawKey")
 	if rawKey == "" {
 		return reply400(ctx, "listen config, raw key is null")
 	}
+	version := ctx.QueryParam("version")
 	enableWatch, _ := strconv.ParseBool(ctx.QueryParam("watch"))
 	listenInternal, _ := strconv.Atoi(ctx.QueryParam("internal"))
 	if listenInternal > 0 {
@@ -136,7 +183,7 @@ func (eng *Engine) listenRawKeyConfig(ctx echo.Context) error {
 		config structs.ContentNode
 		err    error
 	)
-	if config, err = eng.confProxy.ListenRawKeyAppConfig(ctx, rawKey, enableWatch, defaultListenInternal); err != nil {
+	if config, err = eng.confProxy.ListenRawKeyAppConfig(ctx, rawKey, enableWatch, defaultListenInternal, version); err != nil {
 		return reply400(ctx, "no data change")
 	}
 	return reply200(ctx, config)
@@ -144,11 +191,25 @@ func (eng *Engine) listenRawKeyConfig(ctx echo.Context) error {
 
 // getAppConfig get the app config data
 func (eng *Engine) getAppConfig(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
 	appName := ctx.QueryParam("name")
 	appEnv := ctx.QueryParam("env")
 	port := ctx.QueryParam("port")
 	target := ctx.Param("target")
-	res, err := eng.confProxy.GetValues(ctx, appName, appEnv, target, port)
+	value, err := eng.confProxy.GetConfValue(ctx, appName, appEnv, target, port)
+	res := value.Content
+	if value.Scope != "" {
+		ctx.Response().Header().Set(headerConfigScope, value.Scope)
+	}
+	if confProxy.IsStale(err) {
+		return replyStale(ctx, res)
+	}
+	var parseErr *validator.ParseError
+	if errors.As(err, &parseErr) {
+		return replyParseError(ctx, parseErr)
+	}
 	if err != nil {
 		return reply400(ctx, err.Error())
 	}
@@ -156,11 +217,25 @@ func (eng *Engine) getAppConfig(ctx echo.Context) error {
 }
 
 func (eng *Engine) getRawAppConfig(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
 	rawKey := ctx.QueryParam("rawKey")
 	if rawKey == "" {
 		return reply400(ctx, "get raw app config, the raw key is null")
 	}
-	res, err := eng.confProxy.GetRawValues(ctx, rawKey)
+	value, err := eng.confProxy.GetRawConfValue(ctx, rawKey)
+	res := value.Content
+	if value.Scope != "" {
+		ctx.Response().Header().Set(headerConfigScope, value.Scope)
+	}
+	if confProxy.IsStale(err) {
+		return replyStale(ctx, res)
+	}
+	var parseErr *validator.ParseError
+	if errors.As(err, &parseErr) {
+		return replyParseError(ctx, parseErr)
+	}
 	if err != nil {
 		return reply400(ctx, err.Error())
 	}
@@ -169,9 +244,12 @@ func (eng *Engine) getRawAppConfig(ctx echo.Context) error {
 
 // getAppConfigContent
 // 获取应用配置内容
-// 优先获取按host下发的配置，如果获取失败则获取按app下发的配置
-// 不支持多配置文件合并，由客户端自行处理
+// 默认获取按app下发的配置
+// merge=true 时按 cluster -> zone -> host 的顺序合并 toml/yaml/json 配置, 返回合并后的内容
 func (eng *Engine) getAppConfigContent(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
 	var (
 		name   = ctx.QueryParam("name")
 		envi   = ctx.QueryParam("env")
@@ -180,10 +258,24 @@ func (eng *Engine) getAppConfigContent(ctx echo.Context) error {
 	if name == "" || envi == "" {
 		return ctx.JSON(400, nil)
 	}
+	if needMerge, _ := strconv.ParseBool(ctx.QueryParam("merge")); needMerge {
+		bundle, err := eng.confProxy.GetBundle(ctx, name, envi, ctx.QueryParam("port"), true)
+		if confProxy.IsStale(err) {
+			ctx.Response().Header().Set(headerConfigStale, "true")
+		} else if err != nil {
+			return reply400(ctx, err.Error())
+		}
+		if file, ok := bundle[target]; ok {
+			return ctx.String(200, file.Content)
+		}
+		return ctx.JSON(400, nil)
+	}
 
-	appKey := conf.GetString("plugin.confProxy.prefix") + fmt.Sprintf("/%s/%s/%s/static/%s", "cluster", name, envi, target)
+	appKey := structs.ScopeKey(eng.confProxy.Prefix(), structs.ScopeCluster, name, envi, target, "")
 	res, err := eng.confProxy.GetRawValues(ctx, appKey)
-	if err != nil {
+	if confProxy.IsStale(err) {
+		ctx.Response().Header().Set(headerConfigStale, "true")
+	} else if err != nil {
 		return reply400(ctx, err.Error())
 	}
 	if res != "" {
@@ -192,6 +284,108 @@ func (eng *Engine) getAppConfigContent(ctx echo.Context) error {
 	return ctx.JSON(400, nil)
 }
 
+// getConfigBundle get all config files of the app, key is the file name
+// port: optional, only the host config of this port is used
+// merge: merge the toml/yaml/json config of cluster, zone and host, otherwise the config of the highest scope is used
+func (eng *Engine) getConfigBundle(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
+	appName := ctx.QueryParam("name")
+	appEnv := ctx.QueryParam("env")
+	if appName == "" || appEnv == "" {
+		return reply400(ctx, "config bundle, name and env are null")
+	}
+	needMerge, _ := strconv.ParseBool(ctx.QueryParam("merge"))
+	bundle, err := eng.confProxy.GetBundle(ctx, appName, appEnv, ctx.QueryParam("port"), needMerge)
+	if confProxy.IsStale(err) {
+		return replyStale(ctx, bundle)
+	}
+	var parseErr *validator.ParseError
+	if errors.As(err, &parseErr) {
+		return replyParseError(ctx, parseErr)
+	}
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, bundle)
+}
+
+// configVersions list the history versions of a config file written by confProxy
+func (eng *Engine) configVersions(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
+	var param model.ConfigVersionsReq
+	if err := ctx.Bind(&param); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	if param.Path == "" {
+		return reply400(ctx, "path is empty")
+	}
+	versions, err := eng.confProxy.ConfigVersions(param.Path)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, versions)
+}
+
+// configRollback restore a config file to one of its history versions
+func (eng *Engine) configRollback(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
+	var param model.ConfigRollbackReq
+	if err := ctx.Bind(&param); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	if param.Path == "" {
+		return reply400(ctx, "path is empty")
+	}
+	version, err := eng.confProxy.Rollback(param.Path, param.Version)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, version)
+}
+
+// configDrift list the config files which differ from the last applied content
+// scan: check all config files immediately, otherwise return the result of the last periodic check
+func (eng *Engine) configDrift(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
+	scan, _ := strconv.ParseBool(ctx.QueryParam("scan"))
+	return reply200(ctx, eng.confProxy.Drifts(scan))
+}
+
+// configHistory list the audit records of config applies, newest first
+// name, env, file: filter by app/env/file, start, end: unix seconds
+func (eng *Engine) configHistory(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
+	var param model.ConfigHistoryReq
+	if err := ctx.Bind(&param); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	if param.End > 0 && param.Start > param.End {
+		return reply400(ctx, "start is after end")
+	}
+	records, err := eng.confProxy.History(audit.Query{
+		App:   param.Name,
+		Env:   param.Env,
+		File:  param.File,
+		Start: param.Start,
+		End:   param.End,
+		Limit: param.Limit,
+	})
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, records)
+}
+
 // processStatus show the process status of machine
 func (eng *Engine) processStatus(ctx echo.Context) error {
 	list, err := eng.process.GetProcessStatus()
@@ -255,6 +449,26 @@ func reply200(ctx echo.Context, data interface{}) error {
 	})
 }
 
+// replyStale reply the config served from local cache when the config center is unreachable
+func replyStale(ctx echo.Context, data interface{}) error {
+	ctx.Response().Header().Set(headerConfigStale, "true")
+	return ctx.JSON(200, map[string]interface{}{
+		"code":  200,
+		"data":  data,
+		"msg":   "success",
+		"stale": true,
+	})
+}
+
+// replyParseError reply the position of the invalid config content
+func replyParseError(ctx echo.Context, parseErr *validator.ParseError) error {
+	return ctx.JSON(200, map[string]interface{}{
+		"code": 400,
+		"data": parseErr,
+		"msg":  parseErr.Error(),
+	})
+}
+
 func reply400(ctx echo.Context, msg string) error {
 	return ctx.JSON(200, map[string]interface{}{
 		"code": 400,
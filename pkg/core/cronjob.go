@@ -0,0 +1,67 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"net/http"
+
+	"github.com/douyu/juno-agent/pkg/model"
+	"github.com/labstack/echo/v4"
+)
+
+// logWriter write the header before the first output and flush after every write,
+// so the client receives the log as soon as it is written
+type logWriter struct {
+	resp    *echo.Response
+	written bool
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		w.written = true
+		w.resp.Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+		w.resp.Header().Set(echo.HeaderCacheControl, "no-cache")
+		w.resp.Header().Set("X-Accel-Buffering", "no")
+		w.resp.WriteHeader(http.StatusOK)
+	}
+	n, err := w.resp.Write(p)
+	w.resp.Flush()
+	return n, err
+}
+
+// cronTaskLog output the local log of a cron task, follow the log until the task finishes when follow is true
+func (eng *Engine) cronTaskLog(ctx echo.Context) error {
+	var param model.CronTaskLogReq
+	if err := ctx.Bind(&param); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	if param.JobID == "" || param.TaskID == 0 {
+		return reply400(ctx, "job_id and task_id are required")
+	}
+	if eng.worker == nil {
+		return reply400(ctx, "worker is not enabled")
+	}
+
+	out := &logWriter{resp: ctx.Response()}
+	err := eng.worker.TailLog(ctx.Request().Context(), param.JobID, param.TaskID, param.Offset, param.Follow, out)
+	if out.written {
+		// the log has been partly sent, the error can not be replied
+		return nil
+	}
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return ctx.String(http.StatusOK, "")
+}
@@ -22,13 +22,13 @@ import (
 
 	"github.com/douyu/juno-agent/pkg/check"
 	"github.com/douyu/juno-agent/pkg/job"
-	"github.com/douyu/juno-agent/pkg/mbus"
-	"github.com/douyu/juno-agent/pkg/mbus/rocketmq"
 	"github.com/douyu/juno-agent/pkg/nginx"
+	"github.com/douyu/juno-agent/pkg/plugin"
 	"github.com/douyu/juno-agent/pkg/pmt/supervisor"
 	"github.com/douyu/juno-agent/pkg/pmt/systemd"
 	"github.com/douyu/juno-agent/pkg/process"
 	"github.com/douyu/juno-agent/pkg/proxy/confProxy"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/cache"
 	"github.com/douyu/juno-agent/pkg/proxy/regProxy"
 	"github.com/douyu/juno-agent/pkg/report"
 	"github.com/douyu/juno-agent/pkg/structs"
@@ -46,8 +46,8 @@ type Engine struct {
 	registryClient *etcdv3.Client
 	confClient     *etcdv3.Client
 
-	clients []*Client
-	tracer  mbus.Tracer
+	clients  []*Client
+	registry *plugin.Registry
 
 	// Depending on the configuration details, decide which plug-ins to open
 	programs          sync.Map
@@ -55,6 +55,7 @@ type Engine struct {
 	healthCheck       *check.HealthCheck
 	process           *process.Scanner
 	confProxy         *confProxy.ConfProxy
+	confCache         *cache.Cache
 	regProxy          *regProxy.RegProxy
 	report            *report.Report
 	supervisorScanner *supervisor.Scanner
@@ -73,205 +74,78 @@ func NewEngine() *Engine {
 	//)
 
 	if err := eng.Startup(
-		eng.startReportStatus, // start report agent status
-		eng.startNginxConfScanner,
 		eng.loadServiceNode, // load service nodes, and init configurations
-		eng.startProcessScanner,
-		eng.startConfProxy,
-		eng.startRegProxy,
-		eng.startSupervisorScanner, // scan supervisor conf dir in agent mode
-		eng.startSystemdScanner,    // scan systemd conf dir in agent mode
-		eng.startEventLogger,       // start event logger,
-		eng.startShellProxy,        // start shell execution proxy,
-		eng.startHealthScanner,     // start health scanner,
+		eng.startPlugins,    // start report, scanners, proxies and worker in order
+		eng.startHealthScanner,
 		eng.startHealCheck,
 		eng.serveGRPC,
 		eng.serveHTTP,
-		eng.startWorker,
 	); err != nil {
 		xlog.Panic("new engine", xlog.Any("err", err))
 	}
 
-	eng.RegisterHooks(hooks.Stage(jupiter.StageAfterStop), eng.cleanJobs)
+	eng.RegisterHooks(hooks.Stage(jupiter.StageAfterStop), eng.stopPlugins)
 
 	return eng
 }
 
-// loadServiceNode ... TODO
-func (eng *Engine) loadServiceNode() error { // load service node from local storage
-	// recover fast when run fail
-	return nil
-}
-
-// startConfProxy start app conf plugin
-func (eng *Engine) startConfProxy() error {
-	eng.confProxy = confProxy.StdConfig("confProxy").Build()
-	eng.confProxy.Start()
-	xgo.Go(func() {
-		for node := range eng.confProxy.C() {
-			// Monitor the confNode information of confProxy and bring the node into the Engine for management
-			eng.upsertConfClient(node)
-			// 1.0 Prefetch the registration configuration information for the pull configuration client application
-			if err := eng.loadServiceConfiguration(node.AppName); err != nil {
-				xlog.Error("load service configuration")
-			}
-		}
-	})
-	return nil
-}
-
-// startRegProxy start app regist proxy plugin
-func (eng *Engine) startRegProxy() error {
-	eng.regProxy = regProxy.StdConfig("regProxy").Build()
-	if eng.regProxy == nil {
-		return nil
-	}
-
-	if err := eng.regProxy.Start(); err != nil {
+// startPlugins register and start the plugins, the started plugins are stopped in reverse order on stop
+func (eng *Engine) startPlugins() error {
+	eng.registry = plugin.NewRegistry()
+	if err := eng.registry.Register(eng.plugins()...); err != nil {
 		return err
 	}
-
-	xgo.Go(func() {
-		for node := range eng.regProxy.C() {
-			eng.upsertRegClient(node)
-		}
-	})
-	return nil
+	return eng.registry.Start(context.Background())
 }
 
-// startHealthScanner check node health status
-func (eng *Engine) startHealthScanner() error {
-	xgo.Go(
-		eng.checkServiceNodes,
-	)
-	return nil
-}
-
-// startSupervisorScanner check and scan supervisor config
-func (eng *Engine) startSupervisorScanner() error {
-	eng.supervisorScanner = supervisor.StdConfig("supervisor").Build()
-	if err := eng.supervisorScanner.Start(); err != nil {
-		return err
-	}
-	programs, err := eng.supervisorScanner.ListPrograms()
-	if err != nil {
-		xlog.Error("startSupervisorScanner err", xlog.String("err", err.Error()))
-		return nil
-	}
-	for _, program := range programs {
-		eng.updateProgram(program.Unwrap())
+// stopPlugins stop the plugins in reverse order of start
+func (eng *Engine) stopPlugins() {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginStopTimeout)
+	defer cancel()
+	if err := eng.registry.Stop(ctx); err != nil {
+		xlog.Error("stop plugins", xlog.String("err", err.Error()))
 	}
-	xgo.Go(func() {
-		for program := range eng.supervisorScanner.C() {
-			eng.updateProgram(program.Unwrap())
-		}
-	})
-	return nil
 }
 
-// startSystemdScanner check and scan systemd cofig
-func (eng *Engine) startSystemdScanner() error {
-	eng.systemdScanner = systemd.StdConfig("systemd").Build()
-	if err := eng.systemdScanner.Start(); err != nil {
-		return err
-	}
-	programs, err := eng.systemdScanner.ListPrograms()
-	if err != nil {
-		xlog.Debug("startSystemdScanner", xlog.String("err", err.Error()))
+// loadServiceNode load service node from local storage
+// recover fast when run fail: the config cache is warmed before confProxy connects to etcd
+func (eng *Engine) loadServiceNode() error {
+	config := confProxy.StdConfig("confProxy")
+	if !config.Enable {
 		return nil
 	}
-	for _, program := range programs {
-		eng.updateProgram(program.Unwrap())
-	}
-	xgo.Go(func() {
-		for program := range eng.systemdScanner.C() {
-			eng.updateProgram(program.Unwrap())
-		}
-	})
-	return nil
-}
-
-// startProcessScanner check go process
-func (eng *Engine) startProcessScanner() error {
-	eng.process = process.StdConfig("process").Build()
-	if err := eng.process.Start(); err != nil {
-		return err
-	}
-
-	processes, err := eng.process.Scan()
+	eng.confCache = cache.New(config.CacheDir())
+	entries, err := eng.confCache.Warm()
 	if err != nil {
-		return err
+		xlog.Error("loadServiceNode", xlog.String("dir", config.CacheDir()), xlog.String("err", err.Error()))
+		return nil
 	}
-
-	eng.updateProcesses(processes...)
-	xgo.Go(func() {
-		for processes := range eng.process.C() {
-			eng.updateProcesses(processes...)
+	env := structs.EnvFilter(config.Env)
+	for _, entry := range entries {
+		node, err := entry.ConfNode()
+		if err != nil || env.Check(node.AppEnvi) != nil {
+			continue
 		}
-	})
-
-	return nil
-}
-
-// startShellProxy ...
-func (eng *Engine) startShellProxy() error {
-	return nil
-}
-
-// startEventLogger ...
-func (eng *Engine) startEventLogger() error {
-	tracer := rocketmq.New()
-	if err := tracer.Start(); err != nil {
-		return nil
+		eng.upsertConfClient(node)
 	}
-	// eng.tracer = tracer
+	xlog.Info("loadServiceNode", xlog.Int("cached", len(entries)))
 	return nil
 }
 
-// startNginxConfScanner ...
-func (eng *Engine) startNginxConfScanner() error {
-	eng.nginxScanner = nginx.StdConfig("nginx").Build()
-	confs, err := eng.nginxScanner.Scan()
-	if err != nil {
-		xlog.Error("startNginxScanner", xlog.String("err", err.Error()))
-		return nil
-	}
-	for _, conf := range confs {
-		eng.updateNginxProgram(conf)
-	}
-	if err := eng.nginxScanner.Start(); err != nil {
-		return err
-	}
-	xgo.Go(func() {
-		for update := range eng.nginxScanner.C() {
-			eng.updateNginxProgram(update)
-		}
-	})
+// startHealthScanner check node health status
+func (eng *Engine) startHealthScanner() error {
+	xgo.Go(
+		eng.checkServiceNodes,
+	)
 	return nil
 }
 
-// startReportStatus monitor the health status of the machine deployed by the agent, and regularly report the health information to the caller
-func (eng *Engine) startReportStatus() error {
-	eng.report = report.StdConfig("report").Build()
-	err := eng.report.ReportAgentStatus()
-	return err
-}
-
 // startHealCheck health status (including tcp, mysql, redis, http)
 func (eng *Engine) startHealCheck() error {
 	eng.healthCheck = check.StdConfig("healthCheck").Build()
 	return nil
 }
 
-func (eng *Engine) startWorker() error {
-	worker := job.StdConfig("worker").Build()
-	if worker == nil {
-		return nil
-	}
-	eng.worker = worker
-	return worker.Run()
-}
-
 func (eng *Engine) loadServiceConfiguration(name string) interface{} {
 	return nil
 }
@@ -290,6 +164,17 @@ func (eng *Engine) getConfigStatus(configPath string) map[string]bool {
 	return confStatusMap
 }
 
+// configPrograms 返回使用该配置文件的 supervisor/systemd 程序
+func (eng *Engine) configPrograms(configPath string) []*structs.ProgramExt {
+	programs := make([]*structs.ProgramExt, 0)
+	for _, manager := range []string{"supervisor", "systemd"} {
+		if program, ok := eng.programs.Load(fmt.Sprintf("%s_%s", manager, configPath)); ok {
+			programs = append(programs, program.(*structs.ProgramExt))
+		}
+	}
+	return programs
+}
+
 func (eng *Engine) upsertRegClient(node *structs.ServiceNode) {
 	for _, c := range eng.clients {
 		if c.AppName != node.AppName || c.IP != node.IP {
@@ -374,11 +259,3 @@ func (eng *Engine) checkServiceNodes() {
 		}
 	}
 }
-
-func (eng *Engine) cleanJobs() {
-	if eng.worker == nil {
-		return
-	}
-	eng.worker.CleanJobs()
-	return
-}
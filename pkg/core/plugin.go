@@ -0,0 +1,408 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/job"
+	"github.com/douyu/juno-agent/pkg/mbus/rocketmq"
+	"github.com/douyu/juno-agent/pkg/nginx"
+	"github.com/douyu/juno-agent/pkg/plugin"
+	"github.com/douyu/juno-agent/pkg/pmt/supervisor"
+	"github.com/douyu/juno-agent/pkg/pmt/systemd"
+	"github.com/douyu/juno-agent/pkg/process"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy"
+	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// pluginStopTimeout 停止全部组件的超时时间, 超时后不再等待未停止的组件
+const pluginStopTimeout = time.Second * 30
+
+// plugins engine的组件, 按启动顺序排列, 停止时逆序
+func (eng *Engine) plugins() []plugin.Plugin {
+	return []plugin.Plugin{
+		&reportPlugin{eng: eng},
+		&nginxPlugin{eng: eng},
+		&processPlugin{eng: eng},
+		&regProxyPlugin{eng: eng},
+		&supervisorPlugin{eng: eng},
+		&systemdPlugin{eng: eng},
+		// 配置动作需要按配置文件查找 supervisor/systemd 程序, 在扫描程序之后启动
+		&confProxyPlugin{eng: eng},
+		&eventLoggerPlugin{},
+		&shellProxyPlugin{},
+		&workerPlugin{eng: eng},
+	}
+}
+
+// reportPlugin monitor the health status of the machine deployed by the agent, and regularly report the health information to the caller
+type reportPlugin struct {
+	eng *Engine
+}
+
+func (p *reportPlugin) Name() string { return "report" }
+
+func (p *reportPlugin) Start(ctx context.Context) error {
+	p.eng.report = report.StdConfig("report").Build()
+	return p.eng.report.ReportAgentStatus()
+}
+
+func (p *reportPlugin) Stop(ctx context.Context) error {
+	p.eng.report.Stop()
+	return nil
+}
+
+func (p *reportPlugin) Health() plugin.Health {
+	if p.eng.report == nil {
+		return plugin.Health{}
+	}
+	lastErr := p.eng.report.LastError()
+	return plugin.Health{Enabled: p.eng.report.Enabled(), Healthy: lastErr == "", Error: lastErr}
+}
+
+// nginxPlugin scan nginx conf dirs
+type nginxPlugin struct {
+	eng *Engine
+}
+
+func (p *nginxPlugin) Name() string { return "nginx" }
+
+func (p *nginxPlugin) Start(ctx context.Context) error {
+	eng := p.eng
+	eng.nginxScanner = nginx.StdConfig("nginx").Build()
+	confs, err := eng.nginxScanner.Scan()
+	if err != nil {
+		xlog.Error("startNginxScanner", xlog.String("err", err.Error()))
+		return nil
+	}
+	for _, conf := range confs {
+		eng.updateNginxProgram(conf)
+	}
+	if err := eng.nginxScanner.Start(); err != nil {
+		return err
+	}
+	xgo.Go(func() {
+		for update := range eng.nginxScanner.C() {
+			eng.updateNginxProgram(update)
+		}
+	})
+	return nil
+}
+
+func (p *nginxPlugin) Stop(ctx context.Context) error {
+	return p.eng.nginxScanner.Close()
+}
+
+func (p *nginxPlugin) Health() plugin.Health {
+	if p.eng.nginxScanner == nil {
+		return plugin.Health{}
+	}
+	return plugin.Health{Enabled: p.eng.nginxScanner.Enabled(), Healthy: true}
+}
+
+// processPlugin check go process
+type processPlugin struct {
+	eng *Engine
+}
+
+func (p *processPlugin) Name() string { return "process" }
+
+func (p *processPlugin) Start(ctx context.Context) error {
+	eng := p.eng
+	eng.process = process.StdConfig("process").Build()
+	if err := eng.process.Start(); err != nil {
+		return err
+	}
+	processes, err := eng.process.Scan()
+	if err != nil {
+		return err
+	}
+	eng.updateProcesses(processes...)
+	xgo.Go(func() {
+		for processes := range eng.process.C() {
+			eng.updateProcesses(processes...)
+		}
+	})
+	return nil
+}
+
+func (p *processPlugin) Stop(ctx context.Context) error {
+	return p.eng.process.Close()
+}
+
+func (p *processPlugin) Health() plugin.Health {
+	if p.eng.process == nil {
+		return plugin.Health{}
+	}
+	return plugin.Health{Enabled: p.eng.process.Enabled(), Healthy: true}
+}
+
+// confProxyPlugin app conf plugin, Build 在未开启时返回 nil
+type confProxyPlugin struct {
+	eng *Engine
+}
+
+func (p *confProxyPlugin) Name() string { return "confProxy" }
+
+func (p *confProxyPlugin) Start(ctx context.Context) error {
+	eng := p.eng
+	eng.confProxy = confProxy.StdConfig("confProxy").WithCache(eng.confCache).Build()
+	if eng.confProxy == nil {
+		return nil
+	}
+	eng.confProxy.SetProgramResolver(eng.configPrograms)
+	eng.confProxy.Start()
+	xgo.Go(func() {
+		for node := range eng.confProxy.C() {
+			// Monitor the confNode information of confProxy and bring the node into the Engine for management
+			eng.upsertConfClient(node)
+			// 1.0 Prefetch the registration configuration information for the pull configuration client application
+			if err := eng.loadServiceConfiguration(node.AppName); err != nil {
+				xlog.Error("load service configuration")
+			}
+		}
+	})
+	return nil
+}
+
+func (p *confProxyPlugin) Stop(ctx context.Context) error {
+	if p.eng.confProxy != nil {
+		p.eng.confProxy.Close()
+	}
+	return nil
+}
+
+func (p *confProxyPlugin) Health() plugin.Health {
+	if p.eng.confProxy == nil {
+		return plugin.Health{Healthy: true}
+	}
+	status := p.eng.confProxy.ReloadStatus()
+	return plugin.Health{
+		Enabled: true,
+		Healthy: status.Watch.Healthy,
+		Error:   status.Watch.LastError,
+		Detail:  status,
+	}
+}
+
+// regProxyPlugin app regist proxy plugin, Build 在未开启时返回 nil
+type regProxyPlugin struct {
+	eng *Engine
+}
+
+func (p *regProxyPlugin) Name() string { return "regProxy" }
+
+func (p *regProxyPlugin) Start(ctx context.Context) error {
+	eng := p.eng
+	eng.regProxy = regProxy.StdConfig("regProxy").Build()
+	if eng.regProxy == nil {
+		return nil
+	}
+	if err := eng.regProxy.Start(); err != nil {
+		return err
+	}
+	xgo.Go(func() {
+		for node := range eng.regProxy.C() {
+			eng.upsertRegClient(node)
+		}
+	})
+	return nil
+}
+
+func (p *regProxyPlugin) Stop(ctx context.Context) error {
+	if p.eng.regProxy != nil {
+		p.eng.regProxy.Close()
+	}
+	return nil
+}
+
+func (p *regProxyPlugin) Health() plugin.Health {
+	if p.eng.regProxy == nil {
+		return plugin.Health{Healthy: true}
+	}
+	return plugin.Health{Enabled: true, Healthy: p.eng.regProxy.Healthy()}
+}
+
+// supervisorPlugin check and scan supervisor config
+type supervisorPlugin struct {
+	eng *Engine
+}
+
+func (p *supervisorPlugin) Name() string { return "supervisor" }
+
+func (p *supervisorPlugin) Start(ctx context.Context) error {
+	eng := p.eng
+	eng.supervisorScanner = supervisor.StdConfig("supervisor").Build()
+	if err := eng.supervisorScanner.Start(); err != nil {
+		return err
+	}
+	programs, err := eng.supervisorScanner.ListPrograms()
+	if err != nil {
+		xlog.Error("startSupervisorScanner err", xlog.String("err", err.Error()))
+		return nil
+	}
+	for _, program := range programs {
+		eng.updateProgram(program.Unwrap())
+	}
+	xgo.Go(func() {
+		for program := range eng.supervisorScanner.C() {
+			eng.updateProgram(program.Unwrap())
+		}
+	})
+	return nil
+}
+
+func (p *supervisorPlugin) Stop(ctx context.Context) error {
+	return p.eng.supervisorScanner.Close()
+}
+
+func (p *supervisorPlugin) Health() plugin.Health {
+	if p.eng.supervisorScanner == nil {
+		return plugin.Health{}
+	}
+	return plugin.Health{Enabled: p.eng.supervisorScanner.Enabled(), Healthy: true}
+}
+
+// systemdPlugin check and scan systemd config
+type systemdPlugin struct {
+	eng *Engine
+}
+
+func (p *systemdPlugin) Name() string { return "systemd" }
+
+func (p *systemdPlugin) Start(ctx context.Context) error {
+	eng := p.eng
+	eng.systemdScanner = systemd.StdConfig("systemd").Build()
+	if err := eng.systemdScanner.Start(); err != nil {
+		return err
+	}
+	programs, err := eng.systemdScanner.ListPrograms()
+	if err != nil {
+		xlog.Debug("startSystemdScanner", xlog.String("err", err.Error()))
+		return nil
+	}
+	for _, program := range programs {
+		eng.updateProgram(program.Unwrap())
+	}
+	xgo.Go(func() {
+		for program := range eng.systemdScanner.C() {
+			eng.updateProgram(program.Unwrap())
+		}
+	})
+	return nil
+}
+
+func (p *systemdPlugin) Stop(ctx context.Context) error {
+	return p.eng.systemdScanner.Close()
+}
+
+func (p *systemdPlugin) Health() plugin.Health {
+	if p.eng.systemdScanner == nil {
+		return plugin.Health{}
+	}
+	return plugin.Health{Enabled: p.eng.systemdScanner.Enabled(), Healthy: true}
+}
+
+// eventLoggerPlugin event logger, 启动失败不影响其他组件
+type eventLoggerPlugin struct {
+	tracer *rocketmq.MessageQ
+}
+
+func (p *eventLoggerPlugin) Name() string { return "eventLogger" }
+
+func (p *eventLoggerPlugin) Start(ctx context.Context) error {
+	tracer := rocketmq.New()
+	if err := tracer.Start(); err != nil {
+		xlog.Error("startEventLogger", xlog.String("err", err.Error()))
+		return nil
+	}
+	p.tracer = tracer
+	return nil
+}
+
+func (p *eventLoggerPlugin) Stop(ctx context.Context) error {
+	if p.tracer == nil {
+		return nil
+	}
+	return p.tracer.Close()
+}
+
+func (p *eventLoggerPlugin) Health() plugin.Health {
+	return plugin.Health{Enabled: p.tracer != nil, Healthy: true}
+}
+
+// shellProxyPlugin shell execution proxy, 尚未实现
+type shellProxyPlugin struct{}
+
+func (p *shellProxyPlugin) Name() string { return "shellProxy" }
+
+func (p *shellProxyPlugin) Start(ctx context.Context) error { return nil }
+
+func (p *shellProxyPlugin) Stop(ctx context.Context) error { return nil }
+
+func (p *shellProxyPlugin) Health() plugin.Health { return plugin.Health{Healthy: true} }
+
+// workerPlugin cron任务, Run 在后台执行直到 Stop
+type workerPlugin struct {
+	eng *Engine
+
+	mu     sync.RWMutex
+	runErr error
+}
+
+func (p *workerPlugin) Name() string { return "worker" }
+
+func (p *workerPlugin) Start(ctx context.Context) error {
+	worker := job.StdConfig("worker").Build()
+	if worker == nil {
+		return nil
+	}
+	p.eng.worker = worker
+	xgo.Go(func() {
+		if err := worker.Run(); err != nil {
+			xlog.Error("worker run error", xlog.String("err", err.Error()))
+			p.mu.Lock()
+			p.runErr = err
+			p.mu.Unlock()
+		}
+	})
+	return nil
+}
+
+func (p *workerPlugin) Stop(ctx context.Context) error {
+	if p.eng.worker == nil {
+		return nil
+	}
+	return p.eng.worker.Stop(ctx)
+}
+
+func (p *workerPlugin) Health() plugin.Health {
+	if p.eng.worker == nil {
+		return plugin.Health{Healthy: true}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	health := plugin.Health{Enabled: true, Healthy: p.runErr == nil}
+	if p.runErr != nil {
+		health.Error = p.runErr.Error()
+	}
+	return health
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// streamHeartbeat 没有配置变化时定期发送注释行, 避免连接被代理断开
+	streamHeartbeat = time.Second * 30
+	// streamMaxKeys 单个连接最多订阅的配置数量
+	streamMaxKeys = 512
+)
+
+// streamConfig push the config changes of the subscribed keys by Server-Sent Events
+// key: app config key name/env/target/port, rawKey: raw config key, both can be repeated
+// the current config of each key is pushed first, then every change until the client disconnects
+func (eng *Engine) streamConfig(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, errConfProxyDisabled)
+	}
+	params := ctx.QueryParams()
+	keys, rawKeys := params["key"], params["rawKey"]
+	if len(keys)+len(rawKeys) == 0 {
+		return reply400(ctx, "stream config, key and rawKey are null")
+	}
+	if len(keys)+len(rawKeys) > streamMaxKeys {
+		return reply400(ctx, fmt.Sprintf("stream config, at most %d keys", streamMaxKeys))
+	}
+
+	events, cancel := eng.confProxy.WatchConfig(ctx, keys, rawKeys)
+	defer cancel()
+
+	resp := ctx.Response()
+	resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+	resp.Header().Set(echo.HeaderCacheControl, "no-cache")
+	resp.Header().Set(echo.HeaderConnection, "keep-alive")
+	resp.Header().Set("X-Accel-Buffering", "no")
+	resp.WriteHeader(http.StatusOK)
+	resp.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			data, err := jsoniter.Marshal(event)
+			if err != nil {
+				xlog.Error("streamConfig", xlog.String("key", event.Key), xlog.String("err", err.Error()))
+				continue
+			}
+			if _, err := fmt.Fprintf(resp, "event: config\nid: %s\ndata: %s\n\n", event.Version, data); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(resp, ": ping\n\n"); err != nil {
+				return nil
+			}
+		case <-ctx.Request().Context().Done():
+			return nil
+		}
+		resp.Flush()
+	}
+}
@@ -22,6 +22,9 @@ const (
 	ResultKeyPrefix = "/juno/cronjob/result/" // task result (logs and status)
 )
 
+// DefaultLogDir 默认的任务日志目录
+var DefaultLogDir = "/home/www/.config/juno-agent/cronjob"
+
 type Config struct {
 	Enable bool
 
@@ -32,16 +35,30 @@ type Config struct {
 	HostName string
 	AppIP    string
 
-	logger   *xlog.Logger
-	parser   parser.Parser
-	wrappers []cron.JobWrapper
+	LogDir           string // 任务日志目录, 每个任务一个文件 LogDir/jobID/taskID.log
+	LogMaxSize       int64  // 单个任务日志文件的最大字节数, 超过后滚动
+	LogMaxBackups    int    // 单个任务滚动保留的文件数
+	LogMaxAge        int    // 任务日志保留的天数, 小于等于 0 时不清理
+	LogTail          int64  // TaskResult 中保留的日志尾部字节数
+	LogFlushInterval int    // 任务执行中更新 TaskResult 日志的间隔, 单位秒
+
+	logger       *xlog.Logger
+	parser       parser.Parser
+	wrappers     []cron.JobWrapper
+	statusMapper StatusMapper
 }
 
 // DefaultConfig ...
 func DefaultConfig() *Config {
 	return &Config{
-		ReqTimeout: 3,
-		Enable:     false,
+		ReqTimeout:       3,
+		Enable:           false,
+		LogDir:           DefaultLogDir,
+		LogMaxSize:       10 << 20,
+		LogMaxBackups:    3,
+		LogMaxAge:        7,
+		LogTail:          4 << 10,
+		LogFlushInterval: 5,
 	}
 }
 
@@ -56,6 +73,12 @@ func StdConfig(key string) *Config {
 	return config
 }
 
+// WithStatusMapper 设置任务执行结果的状态转换, 任务配置的 ExitCodes 优先
+func (c *Config) WithStatusMapper(mapper StatusMapper) *Config {
+	c.statusMapper = mapper
+	return c
+}
+
 // Build new a instance
 func (c *Config) Build() *Worker {
 	if !c.Enable {
@@ -1,6 +1,12 @@
 package job
 
-import "syscall"
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"syscall"
+)
 
 func makeCmdAttr() *syscall.SysProcAttr {
 	return &syscall.SysProcAttr{
@@ -11,3 +17,31 @@ func makeCmdAttr() *syscall.SysProcAttr {
 func killProcess(pid int) error {
 	return syscall.Kill(-pid, syscall.SIGKILL)
 }
+
+// signalProcess group 为 true 时发送给进程组, 任务进程启动时设置了 Setpgid
+func signalProcess(pid int, group bool, sig syscall.Signal) error {
+	if group {
+		pid = -pid
+	}
+	return syscall.Kill(pid, sig)
+}
+
+func setCredential(attr *syscall.SysProcAttr, userName, groupName string) (*user.User, error) {
+	return nil, errors.New("run job as user is only supported on linux")
+}
+
+// withLimits 只支持 linux, 设置了资源限制时不执行任务
+func withLimits(cmd *exec.Cmd, limits Limits) (func() error, error) {
+	if limits.IsZero() {
+		return func() error { return nil }, nil
+	}
+	return nil, errors.New("job limits are only supported on linux")
+}
+
+// maxRSS 进程最大的常驻内存, darwin 的 Maxrss 单位为字节
+func maxRSS(state *os.ProcessState) int64 {
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return usage.Maxrss
+	}
+	return 0
+}
@@ -1,6 +1,18 @@
 package job
 
-import "syscall"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
 
 func makeCmdAttr() *syscall.SysProcAttr {
 	return &syscall.SysProcAttr{
@@ -11,3 +23,184 @@ func makeCmdAttr() *syscall.SysProcAttr {
 func killProcess(pid int) error {
 	return syscall.Kill(-pid, syscall.SIGKILL)
 }
+
+// signalProcess group 为 true 时发送给进程组, 任务进程启动时设置了 Setpgid
+func signalProcess(pid int, group bool, sig syscall.Signal) error {
+	if group {
+		pid = -pid
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// setCredential 以指定的用户和用户组执行, 只指定用户时使用该用户的主组和附加组
+// 返回指定的用户, 未指定用户时为 nil
+func setCredential(attr *syscall.SysProcAttr, userName, groupName string) (*user.User, error) {
+	credential := &syscall.Credential{
+		Uid: uint32(syscall.Getuid()),
+		Gid: uint32(syscall.Getgid()),
+	}
+	var u *user.User
+	if userName != "" {
+		var err error
+		if u, err = lookupUser(userName); err != nil {
+			return nil, err
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		credential.Uid, credential.Gid = uint32(uid), uint32(gid)
+		if groupName == "" {
+			groupIds, err := u.GroupIds()
+			if err != nil {
+				return nil, fmt.Errorf("lookup groups of user %s: %w", userName, err)
+			}
+			for _, id := range groupIds {
+				gid, err := strconv.ParseUint(id, 10, 32)
+				if err != nil {
+					continue
+				}
+				credential.Groups = append(credential.Groups, uint32(gid))
+			}
+		}
+	}
+	if groupName != "" {
+		g, err := lookupGroup(groupName)
+		if err != nil {
+			return nil, err
+		}
+		gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+		credential.Gid = uint32(gid)
+		// 清空 agent 的附加组
+		credential.Groups = []uint32{}
+	}
+	attr.Credential = credential
+	return u, nil
+}
+
+// lookupUser 支持用户名和uid
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err == nil {
+		return u, nil
+	}
+	if _, convErr := strconv.Atoi(name); convErr == nil {
+		if u, err := user.LookupId(name); err == nil {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("lookup user %s: %w", name, err)
+}
+
+// lookupGroup 支持组名和gid
+func lookupGroup(name string) (*user.Group, error) {
+	g, err := user.LookupGroup(name)
+	if err == nil {
+		return g, nil
+	}
+	if _, convErr := strconv.Atoi(name); convErr == nil {
+		if g, err := user.LookupGroupId(name); err == nil {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("lookup group %s: %w", name, err)
+}
+
+// limitsEnv 子进程设置资源限制后再执行任务脚本, 值为 Limits 的json
+const limitsEnv = "JUNO_AGENT_JOB_LIMITS"
+
+func init() {
+	if os.Getenv(limitsEnv) != "" {
+		execWithLimits()
+	}
+}
+
+// withLimits 资源限制需要在任务脚本执行前设置: 以 agent 自身作为子进程,
+// 设置资源限制后 exec 任务脚本, 失败时通过 fd 3 返回错误并退出, 任务脚本不会执行
+// 返回的函数在 Start 之后调用, 等待子进程 exec 并返回设置资源限制的错误
+func withLimits(cmd *exec.Cmd, limits Limits) (func() error, error) {
+	if limits.IsZero() {
+		return func() error { return nil }, nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("set limits: %w", err)
+	}
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return nil, fmt.Errorf("set limits: %w", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("set limits: %w", err)
+	}
+	cmd.Args = append([]string{self, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = self
+	cmd.Env = append(cmd.Env, limitsEnv+"="+string(data))
+	cmd.ExtraFiles = []*os.File{w}
+	return func() error {
+		// 子进程 exec 或者退出后读取结束
+		_ = w.Close()
+		defer r.Close()
+		msg, err := ioutil.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("set limits: %w", err)
+		}
+		if len(msg) > 0 {
+			return errors.New(string(msg))
+		}
+		return nil
+	}, nil
+}
+
+// execWithLimits 在子进程中设置资源限制后执行任务脚本, 参数为任务脚本和脚本参数
+func execWithLimits() {
+	pipe := os.NewFile(3, "limits")
+	fail := func(err error) {
+		_, _ = pipe.WriteString(err.Error())
+		os.Exit(127)
+	}
+	var limits Limits
+	if err := json.Unmarshal([]byte(os.Getenv(limitsEnv)), &limits); err != nil {
+		fail(fmt.Errorf("parse limits: %w", err))
+	}
+	if len(os.Args) < 2 {
+		fail(errors.New("no script to exec"))
+	}
+	_ = os.Unsetenv(limitsEnv)
+	if err := setLimits(limits); err != nil {
+		fail(err)
+	}
+	syscall.CloseOnExec(3)
+	fail(fmt.Errorf("exec %s: %w", os.Args[1], syscall.Exec(os.Args[1], os.Args[1:], os.Environ())))
+}
+
+// setLimits 设置当前进程的资源限制
+// 使用 syscall.Setrlimit, 否则 exec 时 go 会恢复启动时的 RLIMIT_NOFILE
+func setLimits(limits Limits) error {
+	for _, limit := range []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"cpu", unix.RLIMIT_CPU, limits.CPU},
+		{"memory", unix.RLIMIT_AS, limits.Memory},
+		{"open_files", unix.RLIMIT_NOFILE, limits.OpenFiles},
+		{"processes", unix.RLIMIT_NPROC, limits.Processes},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := &syscall.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := syscall.Setrlimit(limit.resource, rlimit); err != nil {
+			return fmt.Errorf("set %s limit to %d: %w", limit.name, limit.value, err)
+		}
+	}
+	return nil
+}
+
+// maxRSS 进程最大的常驻内存, linux 的 Maxrss 单位为 KB
+func maxRSS(state *os.ProcessState) int64 {
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return usage.Maxrss * 1024
+	}
+	return 0
+}
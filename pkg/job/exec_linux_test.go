@@ -0,0 +1,80 @@
+package job
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithLimits(t *testing.T) {
+	j := &Job{Script: "/bin/sh", Args: []string{"-c", "ulimit -n"}}
+	cmd, err := j.command()
+	assert.Nil(t, err)
+	limited, err := withLimits(cmd, Limits{OpenFiles: 64})
+	assert.Nil(t, err)
+	var output strings.Builder
+	cmd.Stdout = &output
+	assert.Nil(t, cmd.Start())
+	assert.Nil(t, limited())
+	assert.Nil(t, cmd.Wait())
+	assert.Equal(t, "64", strings.TrimSpace(output.String()))
+
+	// 设置失败时任务脚本不执行
+	marker := filepath.Join(t.TempDir(), "ran")
+	j = &Job{Script: "/bin/sh", Args: []string{"-c", "touch " + marker}}
+	cmd, err = j.command()
+	assert.Nil(t, err)
+	limited, err = withLimits(cmd, Limits{OpenFiles: 1 << 40})
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Start())
+	assert.NotNil(t, limited())
+	assert.NotNil(t, cmd.Wait())
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestKiller(t *testing.T) {
+	run := func(script string, policy KillPolicy) (int, string, string, time.Duration) {
+		j := &Job{Script: "/bin/sh", Args: []string{"-c", script}}
+		cmd, err := j.command()
+		assert.Nil(t, err)
+		assert.Nil(t, cmd.Start())
+		// 等待 trap 生效
+		time.Sleep(time.Millisecond * 200)
+		k := newKiller(cmd.Process.Pid, policy)
+		start := time.Now()
+		go k.kill()
+		_ = cmd.Wait()
+		k.done()
+		code, signal := exitStatus(cmd.ProcessState)
+		return code, signal, k.lastSignal(), time.Since(start)
+	}
+
+	// 进程收到 TERM 后退出
+	code, signal, sent, _ := run(`trap "exit 3" TERM; sleep 10 & wait`, KillPolicy{Signal: "TERM", GracePeriod: 5})
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "", signal)
+	assert.Equal(t, "SIGTERM", sent)
+
+	// 忽略 TERM, 宽限期后 KILL
+	code, signal, sent, elapsed := run(`trap "" TERM; sleep 10`, KillPolicy{Signal: "SIGTERM", GracePeriod: 1})
+	assert.Equal(t, -1, code)
+	assert.Equal(t, "SIGKILL", signal)
+	assert.Equal(t, "SIGKILL", sent)
+	assert.True(t, elapsed >= time.Second)
+
+	assert.NotNil(t, KillPolicy{Signal: "NOPE"}.Valid())
+}
+
+func TestMaxRSS(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "exit 2")
+	assert.NotNil(t, cmd.Run())
+	code, _ := exitStatus(cmd.ProcessState)
+	assert.Equal(t, 2, code)
+	assert.Greater(t, maxRSS(cmd.ProcessState), int64(0))
+}
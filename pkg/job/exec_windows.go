@@ -1,7 +1,10 @@
 package job
 
 import (
+	"errors"
+	"os"
 	"os/exec"
+	"os/user"
 	"strconv"
 	"syscall"
 )
@@ -13,3 +16,28 @@ func makeCmdAttr() *syscall.SysProcAttr {
 func killProcess(pid int) error {
 	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
 }
+
+// signalProcess windows 不支持信号, 直接结束进程, group 为 true 时包括子进程
+func signalProcess(pid int, group bool, sig syscall.Signal) error {
+	args := []string{"/F", "/PID", strconv.Itoa(pid)}
+	if group {
+		args = append([]string{"/T"}, args...)
+	}
+	return exec.Command("taskkill", args...).Run()
+}
+
+func setCredential(attr *syscall.SysProcAttr, userName, groupName string) (*user.User, error) {
+	return nil, errors.New("run job as user is only supported on linux")
+}
+
+// withLimits 只支持 linux, 设置了资源限制时不执行任务
+func withLimits(cmd *exec.Cmd, limits Limits) (func() error, error) {
+	if limits.IsZero() {
+		return func() error { return nil }, nil
+	}
+	return nil, errors.New("job limits are only supported on linux")
+}
+
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
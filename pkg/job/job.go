@@ -1,14 +1,15 @@
 package job
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -48,11 +49,35 @@ type Job struct {
 	// 单位秒，如果不大于 0 则马上重试
 	RetryInterval int `json:"retry_interval"`
 
+	// 重试间隔的增长倍数，大于 1 时第 n 次重试的间隔为 RetryInterval * RetryBackoff^(n-1)
+	RetryBackoff float64 `json:"retry_backoff"`
+
+	// 重试间隔的最大值，单位秒，不大于 0 时不限制
+	RetryMaxInterval int `json:"retry_max_interval"`
+
 	// 任务类型
 	// 0: 普通任务，各节点均可运行
 	// 1: 单机任务，同时只能单节点在线
 	JobType int `json:"job_type"`
 
+	// 脚本的参数
+	Args []string `json:"args"`
+	// 追加的环境变量，覆盖 agent 的同名环境变量
+	Envs map[string]string `json:"envs"`
+	// 执行目录，为空时使用 agent 的工作目录
+	WorkDir string `json:"work_dir"`
+	// 执行任务的用户和用户组，为空时使用 agent 的用户，仅 linux 支持
+	// 只设置 User 时使用该用户的主组
+	User  string `json:"user"`
+	Group string `json:"group"`
+	// 资源限制，仅 linux 支持
+	Limits Limits `json:"limits"`
+	// 超时或者手动终止时的处理方式
+	Kill KillPolicy `json:"kill"`
+	// 按退出码设置任务状态，如 {"2": "warning"}，未配置的退出码 0 为 success，其他为 failed
+	// 转换后不是 failed 和 timeout 的执行不再重试
+	ExitCodes map[int]CronTaskStatus `json:"exit_codes"`
+
 	// 执行任务的结点，用于记录 job log
 	runOn    string // worker id
 	hostname string
@@ -64,6 +89,20 @@ type Job struct {
 	locked bool
 }
 
+// Limits 任务进程的资源限制，为 0 时不限制
+// 进程启动后立即设置，之后创建的子进程继承该限制
+type Limits struct {
+	CPU       uint64 `json:"cpu"`        // CPU 时间，单位秒
+	Memory    uint64 `json:"memory"`     // 虚拟内存，单位字节
+	OpenFiles uint64 `json:"open_files"` // 打开的文件数
+	Processes uint64 `json:"processes"`  // 执行用户的进程数
+}
+
+// IsZero ...
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
 // NewEtcdTimeoutContext return a new etcdTimeoutContext
 func NewEtcdTimeoutContext(w *Worker) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), time.Duration(w.ReqTimeout)*time.Second)
@@ -96,16 +135,99 @@ func GetIDFromKey(key string) string {
 	return key[index+1:]
 }
 
+// Run 执行任务, 通过 WithRetry 设置失败后的重试次数, 所有执行记录在同一个任务中
 func (j *Job) Run(taskOptions ...TaskOption) error {
+	task := NewTask(j, taskOptions...)
+	log := j.Worker.newTaskLog(j.ID, task.TaskID)
+	defer j.Worker.closeTaskLog(j.ID, task.TaskID, log)
+	task.log = log
+	j.Worker.running.Store(task.TaskID, task)
+	defer j.Worker.running.Delete(task.TaskID)
+	_ = task.SetStatus(CronTaskStatusProcessing, "")
+
+	stopFlush := task.flushLogs(time.Duration(j.LogFlushInterval) * time.Second)
 	var (
-		cmd           *exec.Cmd
-		ctx           context.Context
-		cancel        context.CancelFunc
-		consoleLogBuf bytes.Buffer
+		status CronTaskStatus
+		err    error
 	)
+	for attempt := 1; ; attempt++ {
+		if task.retries > 0 {
+			log.WriteString(fmt.Sprintf("=== attempt %d/%d ===\n", attempt, task.retries+1))
+		}
+		log.startAttempt()
+		result := TaskAttempt{Attempt: attempt, ExitCode: -1, StartedAt: time.Now()}
+		status, err = j.runAttempt(task, &result)
+		result.Duration = time.Since(result.StartedAt).Milliseconds()
+		result.Logs = log.attemptTail()
+		result.Error = errorString(err)
+		status, err = j.mapStatus(status, err, result)
+		result.Status = status
+		task.addAttempt(result)
+		if err == nil || attempt > task.retries || task.isKilled() {
+			break
+		}
+		interval := j.retryInterval(attempt)
+		j.logger.Info("job run failed, retry", xlog.String("jobId", j.ID), xlog.Int("attempt", attempt),
+			xlog.String("interval", interval.String()), xlog.String("err", err.Error()))
+		if !task.wait(interval) {
+			log.WriteString("retry canceled\n")
+			break
+		}
+	}
+	// 停止更新日志后再写入最终状态, 避免被执行中的状态覆盖
+	stopFlush()
+	_ = task.SetStatus(status, log.String())
+	return err
+}
 
-	task := NewTask(j, taskOptions...)
-	_ = task.SetStatus(CronTaskStatusProcessing, "")
+// retryInterval 第 attempt 次执行失败后的等待时间
+// RetryBackoff 大于 1 时按指数增长, 不超过 RetryMaxInterval
+func (j *Job) retryInterval(attempt int) time.Duration {
+	interval := float64(j.RetryInterval)
+	if j.RetryBackoff > 1 {
+		interval *= math.Pow(j.RetryBackoff, float64(attempt-1))
+	}
+	if j.RetryMaxInterval > 0 && interval > float64(j.RetryMaxInterval) {
+		interval = float64(j.RetryMaxInterval)
+	}
+	return time.Duration(interval * float64(time.Second))
+}
+
+// mapStatus 按任务的 ExitCodes 和 worker 的 StatusMapper 转换执行结果的状态
+// 转换后为 failed 或者 timeout 的执行返回错误, 其他状态不再重试
+func (j *Job) mapStatus(status CronTaskStatus, err error, result TaskAttempt) (CronTaskStatus, error) {
+	mapped := status
+	// 超时或者没有正常退出时不转换
+	if status != CronTaskStatusTimeout && result.ExitCode >= 0 {
+		if s, ok := j.ExitCodes[result.ExitCode]; ok {
+			mapped = s
+		} else if j.Worker != nil && j.statusMapper != nil {
+			if s := j.statusMapper(j, result); s != "" {
+				mapped = s
+			}
+		}
+	}
+	if mapped == status {
+		return status, err
+	}
+	if mapped.Failed() {
+		if err == nil {
+			err = fmt.Errorf("exit code %d is mapped to status %s", result.ExitCode, mapped)
+		}
+		return mapped, err
+	}
+	return mapped, nil
+}
+
+// runAttempt 执行一次脚本, 返回本次执行的状态, 退出状态和资源使用记录到 result
+func (j *Job) runAttempt(task *Task, result *TaskAttempt) (CronTaskStatus, error) {
+	var (
+		cmd    *exec.Cmd
+		ctx    context.Context
+		cancel context.CancelFunc
+		log    = task.log
+	)
+	task.setExit(-1, "", "")
 
 	if j.Timeout > 0 {
 		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(j.Timeout)*time.Second)
@@ -116,36 +238,53 @@ func (j *Job) Run(taskOptions ...TaskOption) error {
 	}
 
 	// check if script exists
-	scriptFileState, err := os.Stat(j.Script)
+	scriptFileState, err := os.Stat(j.scriptPath())
 	if err != nil {
 		j.logger.Error("read script file failed", xlog.String("err", err.Error()))
 
-		consoleLogBuf.WriteString("read script file failed: " + err.Error())
-		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
-
-		return err
+		log.WriteString("read script file failed: " + err.Error() + "\n")
+		return CronTaskStatusFailed, err
 	} else if scriptFileState.IsDir() {
 		j.logger.Error("script path is a dir", xlog.String("script", j.Script))
 
-		consoleLogBuf.WriteString("script path is a dir, not a executable file")
-		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+		log.WriteString("script path is a dir, not a executable file\n")
+		return CronTaskStatusFailed, fmt.Errorf("script is a dir, not a executable file. jobId[%s] script[%s]", j.ID, j.Script)
+	}
+
+	j.logger.Sugar().Infof("command is : %s %s", j.Script, strings.Join(j.Args, " "))
+	cmd, err = j.command()
+	if err != nil {
+		j.logger.Error("build command failed", xlog.String("err", err.Error()))
 
-		return fmt.Errorf("script is a dir, not a executable file. jobId[%s] script[%s]", j.ID, j.Script)
+		log.WriteString(err.Error() + "\n")
+		return CronTaskStatusFailed, err
 	}
 
-	j.logger.Sugar().Infof("command is : %s", j.Script)
-	cmd = exec.CommandContext(ctx, j.Script)
+	// 资源限制在任务脚本执行前设置, 设置失败时任务脚本不会执行
+	limited, err := withLimits(cmd, j.Limits)
+	if err != nil {
+		j.logger.Error("set limits failed", xlog.String("err", err.Error()))
+
+		log.WriteString("set limits failed: " + err.Error() + "\n")
+		return CronTaskStatusFailed, err
+	}
 
-	sysProcAttr := makeCmdAttr()
-	cmd.SysProcAttr = sysProcAttr
-	cmd.Stdout = &consoleLogBuf
-	cmd.Stderr = &consoleLogBuf
+	cmd.Stdout = log
+	cmd.Stderr = log
 	if err := cmd.Start(); err != nil {
-		j.logger.Info(consoleLogBuf.String())
+		_ = limited()
+		j.logger.Error("start command failed", xlog.String("err", err.Error()))
 
-		consoleLogBuf.WriteString(err.Error())
-		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
-		return err
+		log.WriteString(err.Error() + "\n")
+		return CronTaskStatusFailed, err
+	}
+
+	if err := limited(); err != nil {
+		j.logger.Error("set limits failed", xlog.String("err", err.Error()))
+		_ = cmd.Wait()
+
+		log.WriteString("set limits failed: " + err.Error() + "\n")
+		return CronTaskStatusFailed, err
 	}
 
 	proc := &Process{
@@ -165,23 +304,89 @@ func (j *Job) Run(taskOptions ...TaskOption) error {
 		}()
 	}()
 
-	if err := cmd.Wait(); err != nil {
-		j.logger.Error(consoleLogBuf.String())
-		consoleLogBuf.WriteString(err.Error())
+	// 超时或者手动终止时按 KillPolicy 结束进程
+	k := newKiller(cmd.Process.Pid, j.Kill)
+	task.setKiller(k)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				log.WriteString(fmt.Sprintf("job timeout after %ds, kill with policy %s\n", j.Timeout, j.Kill))
+			}
+			k.kill()
+		case <-k.exited:
+		}
+	}()
+
+	err = cmd.Wait()
+	k.done()
+	task.setKiller(nil)
+	result.ExitCode, result.Signal = exitStatus(cmd.ProcessState)
+	if state := cmd.ProcessState; state != nil {
+		result.UserTime = state.UserTime().Milliseconds()
+		result.SysTime = state.SystemTime().Milliseconds()
+		result.MaxRSS = maxRSS(state)
+	}
+	task.setExit(result.ExitCode, result.Signal, k.lastSignal())
+	if err != nil {
+		j.logger.Error("job run failed", xlog.String("jobId", j.ID), xlog.String("err", err.Error()))
+		log.WriteString(err.Error() + "\n")
 
 		if ctx.Err() == context.DeadlineExceeded {
-			_ = task.SetStatus(CronTaskStatusTimeout, consoleLogBuf.String())
-		} else {
-			_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+			return CronTaskStatusTimeout, err
 		}
+		return CronTaskStatusFailed, err
+	}
+	return CronTaskStatusSuccess, nil
+}
 
-		return err
+func errorString(err error) string {
+	if err == nil {
+		return ""
 	}
+	return err.Error()
+}
 
-	j.logger.Info(consoleLogBuf.String())
-	_ = task.SetStatus(CronTaskStatusSuccess, consoleLogBuf.String())
+// scriptPath 返回脚本的绝对路径, 相对路径的脚本在执行目录中查找
+// 执行时使用绝对路径, 避免 exec.Command 从 $PATH 中查找同名的命令
+func (j *Job) scriptPath() string {
+	scriptPath := j.Script
+	if !filepath.IsAbs(scriptPath) && j.WorkDir != "" {
+		scriptPath = filepath.Join(j.WorkDir, scriptPath)
+	}
+	if abs, err := filepath.Abs(scriptPath); err == nil {
+		return abs
+	}
+	return scriptPath
+}
 
-	return nil
+// command 按任务的参数、环境变量、执行目录和用户创建命令, 超时由 KillPolicy 处理
+func (j *Job) command() (*exec.Cmd, error) {
+	cmd := exec.Command(j.scriptPath(), j.Args...)
+	cmd.Dir = j.WorkDir
+	cmd.SysProcAttr = makeCmdAttr()
+
+	env := os.Environ()
+	if j.User != "" || j.Group != "" {
+		u, err := setCredential(cmd.SysProcAttr, j.User, j.Group)
+		if err != nil {
+			return nil, err
+		}
+		if u != nil {
+			env = append(env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+		}
+	}
+	keys := make([]string, 0, len(j.Envs))
+	for key := range j.Envs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// 同名的环境变量以最后一个为准
+		env = append(env, key+"="+j.Envs[key])
+	}
+	cmd.Env = env
+	return cmd, nil
 }
 
 func (j *Job) RunWithRecovery() {
@@ -202,7 +407,14 @@ func (j *Job) ValidRules() error {
 			return err
 		}
 	}
-	return nil
+	for code, status := range j.ExitCodes {
+		switch status {
+		case CronTaskStatusSuccess, CronTaskStatusFailed, CronTaskStatusWarning:
+		default:
+			return fmt.Errorf("invalid status %q of exit code %d", status, code)
+		}
+	}
+	return j.Kill.Valid()
 }
 
 func (j *Job) Lock() error {
@@ -268,24 +480,11 @@ func (c *Cmd) GetID() string {
 	return c.Job.ID + "-" + c.Timer.ID
 }
 
+// Run 失败后按 RetryCount 重试, 成功后不再重试
 func (c *Cmd) Run() error {
-	if c.Job.RetryCount <= 0 {
-		err := c.Job.Run()
-		if err != nil {
-			c.logger.Info("job run failed : ", xlog.FieldErr(err))
-		}
-		return err
-	}
-
-	for i := 0; i <= c.Job.RetryCount; i++ {
-		if err := c.Job.Run(); err != nil {
-			c.logger.Info("job run failed", xlog.FieldErr(err))
-		}
-
-		if c.Job.RetryInterval > 0 {
-			time.Sleep(time.Duration(c.Job.RetryInterval) * time.Second)
-		}
+	err := c.Job.Run(WithRetry(c.Job.RetryCount))
+	if err != nil {
+		c.logger.Info("job run failed", xlog.FieldErr(err))
 	}
-
-	return nil
+	return err
 }
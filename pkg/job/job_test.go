@@ -0,0 +1,96 @@
+package job
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJob_Command(t *testing.T) {
+	dir := t.TempDir()
+	j := &Job{
+		Script:  "/bin/sh",
+		Args:    []string{"-c", "pwd; echo $JOB_NAME; echo $HOME"},
+		Envs:    map[string]string{"JOB_NAME": "demo", "HOME": "/job/home"},
+		WorkDir: dir,
+	}
+	cmd, err := j.command()
+	assert.Nil(t, err)
+	output, err := cmd.Output()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{dir, "demo", "/job/home"}, strings.Split(strings.TrimSpace(string(output)), "\n"))
+
+	// 相对路径的脚本在执行目录中查找, 不使用 $PATH 中的同名命令
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "sh"), []byte("#!/bin/sh\necho local\n"), 0755))
+	j.Script, j.Args = "sh", nil
+	cmd, err = j.command()
+	assert.Nil(t, err)
+	output, err = cmd.Output()
+	assert.Nil(t, err)
+	assert.Equal(t, "local", strings.TrimSpace(string(output)))
+
+	// 不存在的用户
+	j.User = "juno-agent-not-exist"
+	_, err = j.command()
+	assert.NotNil(t, err)
+}
+
+func TestJob_RetryInterval(t *testing.T) {
+	j := &Job{RetryInterval: 2}
+	assert.Equal(t, 2*time.Second, j.retryInterval(1))
+	assert.Equal(t, 2*time.Second, j.retryInterval(3))
+
+	// 指数增长, 不超过最大值
+	j.RetryBackoff, j.RetryMaxInterval = 2, 10
+	assert.Equal(t, 2*time.Second, j.retryInterval(1))
+	assert.Equal(t, 4*time.Second, j.retryInterval(2))
+	assert.Equal(t, 8*time.Second, j.retryInterval(3))
+	assert.Equal(t, 10*time.Second, j.retryInterval(4))
+}
+
+func TestTask_Kill(t *testing.T) {
+	task := &Task{job: &Job{Worker: &Worker{done: make(chan struct{})}}, killCh: make(chan struct{})}
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		task.kill()
+	}()
+	// 手动终止后不再等待重试
+	assert.False(t, task.wait(time.Minute))
+	assert.True(t, task.isKilled())
+	task.kill()
+}
+
+func TestJob_MapStatus(t *testing.T) {
+	failed := errors.New("exit status 2")
+	j := &Job{
+		Worker:    &Worker{Config: &Config{}},
+		ExitCodes: map[int]CronTaskStatus{2: CronTaskStatusWarning},
+	}
+	status, err := j.mapStatus(CronTaskStatusFailed, failed, TaskAttempt{ExitCode: 2})
+	assert.Equal(t, CronTaskStatusWarning, status)
+	assert.Nil(t, err)
+
+	// 超时不转换
+	status, err = j.mapStatus(CronTaskStatusTimeout, failed, TaskAttempt{ExitCode: 2})
+	assert.Equal(t, CronTaskStatusTimeout, status)
+	assert.Equal(t, failed, err)
+
+	// 按输出转换, 转换为失败后需要重试
+	j.WithStatusMapper(func(job *Job, result TaskAttempt) CronTaskStatus {
+		if strings.Contains(result.Logs, "ERROR") {
+			return CronTaskStatusFailed
+		}
+		return ""
+	})
+	status, err = j.mapStatus(CronTaskStatusSuccess, nil, TaskAttempt{ExitCode: 0, Logs: "ERROR: no data\n"})
+	assert.Equal(t, CronTaskStatusFailed, status)
+	assert.NotNil(t, err)
+	status, err = j.mapStatus(CronTaskStatusSuccess, nil, TaskAttempt{ExitCode: 0, Logs: "done\n"})
+	assert.Equal(t, CronTaskStatusSuccess, status)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,126 @@
+package job
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/douyu/juno-agent/util"
+)
+
+// KillPolicy 任务超时或者被手动终止时的处理方式
+// 先发送 Signal, 等待 GracePeriod 秒后进程仍未退出时发送 KILL
+type KillPolicy struct {
+	Signal      string `json:"signal"`       // 如 TERM、SIGINT 或者信号值, 为空时直接发送 KILL
+	GracePeriod int64  `json:"grace_period"` // 单位秒, 不大于 0 时发送 Signal 后立即发送 KILL
+	// 是否发送给任务的整个进程组, 默认为 true, 为 false 时只发送给脚本进程
+	ProcessGroup *bool `json:"process_group"`
+}
+
+// Valid ...
+func (p KillPolicy) Valid() error {
+	_, err := parseSignal(p.Signal)
+	return err
+}
+
+// String ...
+func (p KillPolicy) String() string {
+	sig, err := parseSignal(p.Signal)
+	if err != nil {
+		sig = syscall.SIGKILL
+	}
+	return fmt.Sprintf("signal=%s grace_period=%ds process_group=%t", util.SignalName(sig), p.GracePeriod, p.group())
+}
+
+func (p KillPolicy) group() bool {
+	return p.ProcessGroup == nil || *p.ProcessGroup
+}
+
+// parseSignal 支持 TERM、SIGTERM 以及信号值, 为空时为 KILL
+func parseSignal(name string) (syscall.Signal, error) {
+	return util.ParseSignal(name, syscall.SIGKILL)
+}
+
+// killer 按 KillPolicy 终止任务进程, 同一个进程只执行一次
+type killer struct {
+	pid    int
+	policy KillPolicy
+
+	once   sync.Once
+	exited chan struct{}
+
+	mu   sync.Mutex
+	sent syscall.Signal
+}
+
+func newKiller(pid int, policy KillPolicy) *killer {
+	return &killer{pid: pid, policy: policy, exited: make(chan struct{})}
+}
+
+// kill 发送信号并等待进程退出, 宽限期结束后仍未退出时发送 KILL
+func (k *killer) kill() {
+	k.once.Do(func() {
+		sig, err := parseSignal(k.policy.Signal)
+		if err != nil {
+			sig = syscall.SIGKILL
+		}
+		if !k.signal(sig) || sig == syscall.SIGKILL {
+			return
+		}
+		if k.policy.GracePeriod > 0 {
+			timer := time.NewTimer(time.Duration(k.policy.GracePeriod) * time.Second)
+			defer timer.Stop()
+			select {
+			case <-k.exited:
+				return
+			case <-timer.C:
+			}
+		}
+		k.signal(syscall.SIGKILL)
+	})
+}
+
+// signal 进程已退出时返回 false
+func (k *killer) signal(sig syscall.Signal) bool {
+	select {
+	case <-k.exited:
+		return false
+	default:
+	}
+	k.mu.Lock()
+	k.sent = sig
+	k.mu.Unlock()
+	if err := signalProcess(k.pid, k.policy.group(), sig); err != nil {
+		return false
+	}
+	return true
+}
+
+// done 进程已退出
+func (k *killer) done() {
+	close(k.exited)
+}
+
+// lastSignal 最后发送的信号, 未发送时为空
+func (k *killer) lastSignal() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.sent == 0 {
+		return ""
+	}
+	return util.SignalName(k.sent)
+}
+
+// exitStatus 进程的退出码以及导致进程退出的信号
+func exitStatus(state *os.ProcessState) (code int, signal string) {
+	if state == nil {
+		return -1, ""
+	}
+	code = state.ExitCode()
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		signal = util.SignalName(status.Signal())
+	}
+	return code, signal
+}
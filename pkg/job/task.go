@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/douyu/jupiter/pkg/xlog"
@@ -16,6 +17,18 @@ type (
 		job        *Job
 		executedAt time.Time
 		finishedAt *time.Time
+		log        *taskLog
+		// 失败后的重试次数
+		retries int
+
+		mu         sync.Mutex
+		exitCode   int
+		signal     string
+		killSignal string
+		attempts   []TaskAttempt
+		killer     *killer
+		killed     bool
+		killCh     chan struct{}
 	}
 
 	TaskOption func(t *Task)
@@ -26,11 +39,40 @@ type (
 		TaskID     uint64         `json:"task_id"`
 		Status     CronTaskStatus `json:"status"`
 		Job        *Job           `json:"job"`
-		Logs       string         `json:"logs"`
+		Logs       string         `json:"logs"`        // 最后 LogTail 字节的输出
+		LogFile    string         `json:"log_file"`    // 执行节点上的完整日志
+		LogSize    int64          `json:"log_size"`    // 输出的总字节数
+		ExitCode   int            `json:"exit_code"`   // 进程的退出码, 未执行或者被信号终止时为 -1
+		Signal     string         `json:"signal"`      // 导致进程退出的信号, 如 SIGKILL
+		KillSignal string         `json:"kill_signal"` // agent 最后发送给进程的信号, 超时或者手动终止时设置
+		WallTime   int64          `json:"wall_time"`   // 从开始执行到结束的时间, 包括重试的等待, 单位毫秒
+		UserTime   int64          `json:"user_time"`   // 所有执行的用户态CPU时间, 单位毫秒
+		SysTime    int64          `json:"sys_time"`    // 所有执行的内核态CPU时间, 单位毫秒
+		MaxRSS     int64          `json:"max_rss"`     // 所有执行中最大的常驻内存, 单位字节
+		Attempts   []TaskAttempt  `json:"attempts"`    // 每一次执行的结果, 包括重试
 		RunOn      string         `json:"run_on"`
 		ExecutedAt time.Time      `json:"executed_at"`
 		FinishedAt *time.Time     `json:"finished_at"`
 	}
+
+	// TaskAttempt 任务的一次执行
+	TaskAttempt struct {
+		Attempt   int            `json:"attempt"` // 从 1 开始
+		Status    CronTaskStatus `json:"status"`
+		ExitCode  int            `json:"exit_code"`
+		Signal    string         `json:"signal"`
+		Error     string         `json:"error"`
+		StartedAt time.Time      `json:"started_at"`
+		Duration  int64          `json:"duration"`  // 单位毫秒
+		UserTime  int64          `json:"user_time"` // 单位毫秒
+		SysTime   int64          `json:"sys_time"`  // 单位毫秒
+		MaxRSS    int64          `json:"max_rss"`   // 单位字节, 仅 linux 和 darwin 支持
+		Logs      string         `json:"logs"`      // 本次执行最后的输出
+	}
+
+	// StatusMapper 根据一次执行的结果返回任务状态, 返回空时使用默认的状态
+	// 可以按退出码或者输出区分失败的类型, 如返回 warning
+	StatusMapper func(job *Job, result TaskAttempt) CronTaskStatus
 )
 
 var (
@@ -38,12 +80,20 @@ var (
 	CronTaskStatusSuccess    CronTaskStatus = "success"
 	CronTaskStatusFailed     CronTaskStatus = "failed"
 	CronTaskStatusTimeout    CronTaskStatus = "timeout"
+	CronTaskStatusWarning    CronTaskStatus = "warning"
 )
 
+// Failed 失败或者超时, 需要重试
+func (s CronTaskStatus) Failed() bool {
+	return s == CronTaskStatusFailed || s == CronTaskStatusTimeout
+}
+
 func NewTask(job *Job, ops ...TaskOption) *Task {
 	task := &Task{
 		job:        job,
 		executedAt: time.Now(),
+		exitCode:   -1,
+		killCh:     make(chan struct{}),
 	}
 	for _, op := range ops {
 		op(task)
@@ -57,11 +107,12 @@ func NewTask(job *Job, ops ...TaskOption) *Task {
 }
 
 func (t *Task) SetStatus(status CronTaskStatus, logs string) error {
-	if status == CronTaskStatusSuccess || status == CronTaskStatusFailed || status == CronTaskStatusTimeout {
+	if status != CronTaskStatusProcessing {
 		now := time.Now()
 		t.finishedAt = &now
 	}
 
+	t.mu.Lock()
 	payload := TaskResult{
 		TaskID:     t.TaskID,
 		Job:        t.job,
@@ -70,6 +121,26 @@ func (t *Task) SetStatus(status CronTaskStatus, logs string) error {
 		RunOn:      t.job.HostName,
 		ExecutedAt: t.executedAt,
 		FinishedAt: t.finishedAt,
+		ExitCode:   t.exitCode,
+		Signal:     t.signal,
+		KillSignal: t.killSignal,
+		Attempts:   append([]TaskAttempt(nil), t.attempts...),
+	}
+	t.mu.Unlock()
+	payload.WallTime = time.Since(t.executedAt).Milliseconds()
+	if t.finishedAt != nil {
+		payload.WallTime = t.finishedAt.Sub(t.executedAt).Milliseconds()
+	}
+	for _, attempt := range payload.Attempts {
+		payload.UserTime += attempt.UserTime
+		payload.SysTime += attempt.SysTime
+		if attempt.MaxRSS > payload.MaxRSS {
+			payload.MaxRSS = attempt.MaxRSS
+		}
+	}
+	if t.log != nil {
+		payload.LogFile = t.log.path
+		payload.LogSize = t.log.Size()
 	}
 	payloadBytes, _ := json.Marshal(&payload)
 
@@ -80,6 +151,94 @@ func (t *Task) SetStatus(status CronTaskStatus, logs string) error {
 	return err
 }
 
+// flushLogs 任务执行中定期把新的输出写入 TaskResult, 返回的函数停止更新并等待正在进行的写入完成
+func (t *Task) flushLogs(interval time.Duration) (stop func()) {
+	if interval <= 0 || t.log == nil {
+		return func() {}
+	}
+	var (
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if tail, changed := t.log.Tail(); changed {
+					_ = t.SetStatus(CronTaskStatusProcessing, tail)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// setExit 记录最近一次执行的退出状态
+func (t *Task) setExit(exitCode int, signal, killSignal string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.exitCode, t.signal, t.killSignal = exitCode, signal, killSignal
+}
+
+func (t *Task) addAttempt(attempt TaskAttempt) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.attempts = append(t.attempts, attempt)
+}
+
+// setKiller 设置正在执行的进程, 已被手动终止时立即终止新的进程
+func (t *Task) setKiller(k *killer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.killer = k
+	if k != nil && t.killed {
+		go k.kill()
+	}
+}
+
+// kill 手动终止任务, 按 KillPolicy 结束正在执行的进程, 并且不再重试
+func (t *Task) kill() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.killed {
+		return
+	}
+	t.killed = true
+	close(t.killCh)
+	if t.killer != nil {
+		go t.killer.kill()
+	}
+}
+
+func (t *Task) isKilled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.killed
+}
+
+// wait 等待重试, 任务被手动终止或者 worker 停止时返回 false
+func (t *Task) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-t.killCh:
+		return false
+	case <-t.job.Worker.done:
+		return false
+	}
+}
+
 func (t *Task) Key() string {
 	return fmt.Sprintf("%s%s/%d", ResultKeyPrefix, t.job.ID, t.TaskID)
 }
@@ -91,6 +250,13 @@ func (t *Task) Stop() {
 	}
 }
 
+// WithRetry 失败后最多重试 count 次
+func WithRetry(count int) TaskOption {
+	return func(t *Task) {
+		t.retries = count
+	}
+}
+
 func WithTaskID(taskId uint64) TaskOption {
 	return func(t *Task) {
 		t.TaskID = taskId
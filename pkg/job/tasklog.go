@@ -0,0 +1,372 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/circbuf"
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	// tailPollInterval 跟踪执行中任务的日志时检查新内容的间隔
+	tailPollInterval = time.Millisecond * 500
+	// attemptTailSize TaskAttempt 中保留的输出字节数
+	attemptTailSize = 1 << 10
+)
+
+var (
+	// ErrTaskLogNotFound 任务日志不存在
+	ErrTaskLogNotFound = errors.New("task log not found")
+)
+
+// taskLog 任务的输出, 写入本地滚动日志, 并保留最后一部分用于写入 TaskResult
+// path 为空时不写入本地日志, 只保留最后一部分
+type taskLog struct {
+	path string
+	file *util.RotateFile
+
+	mu    sync.Mutex
+	tail  *circbuf.Buffer
+	dirty bool
+	// 当前这次执行的输出
+	attempt *circbuf.Buffer
+	// 第一次写入本地日志失败的错误, 之后的输出只保留在 tail 中
+	fileErr error
+
+	done chan struct{}
+	once sync.Once
+}
+
+func newTaskLog(path string, maxSize int64, maxBackups int, tailSize int64) *taskLog {
+	if tailSize <= 0 {
+		tailSize = DefaultConfig().LogTail
+	}
+	tail, _ := circbuf.NewBuffer(tailSize)
+	log := &taskLog{
+		path: path,
+		tail: tail,
+		done: make(chan struct{}),
+	}
+	if path != "" {
+		log.file = util.NewRotateFile(path, maxSize, maxBackups)
+	}
+	return log
+}
+
+// Write 本地日志写入失败时不影响任务执行
+func (l *taskLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil && l.fileErr == nil {
+		if _, err := l.file.Write(p); err != nil {
+			l.fileErr = err
+			xlog.Error("write task log failed", xlog.String("path", l.path), xlog.String("err", err.Error()))
+		}
+	}
+	_, _ = l.tail.Write(p)
+	if l.attempt != nil {
+		_, _ = l.attempt.Write(p)
+	}
+	l.dirty = true
+	return len(p), nil
+}
+
+// WriteString ...
+func (l *taskLog) WriteString(s string) {
+	_, _ = l.Write([]byte(s))
+}
+
+// Tail 返回最后写入的内容, changed 表示上次调用之后是否有新的输出
+func (l *taskLog) Tail() (tail string, changed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	changed, l.dirty = l.dirty, false
+	return l.tail.String(), changed
+}
+
+// String ...
+func (l *taskLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tail.String()
+}
+
+// startAttempt 开始新的一次执行
+func (l *taskLog) startAttempt() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.attempt, _ = circbuf.NewBuffer(attemptTailSize)
+}
+
+// attemptTail 当前这次执行最后的输出
+func (l *taskLog) attemptTail() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.attempt == nil {
+		return ""
+	}
+	return l.attempt.String()
+}
+
+// Size 写入的总字节数
+func (l *taskLog) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tail.TotalWritten()
+}
+
+// Close 任务结束, 正在跟踪日志的请求读完剩余内容后返回
+func (l *taskLog) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// taskLogPath 任务日志路径 LogDir/jobID/taskID.log
+func (c *Config) taskLogPath(jobID string, taskID uint64) (string, error) {
+	if jobID == "" || jobID != filepath.Base(jobID) || strings.HasPrefix(jobID, ".") {
+		return "", fmt.Errorf("invalid job id: %q", jobID)
+	}
+	return filepath.Join(c.LogDir, jobID, fmt.Sprintf("%d.log", taskID)), nil
+}
+
+// taskLogKey 执行中的任务日志按任务和执行记录区分
+type taskLogKey struct {
+	jobID  string
+	taskID uint64
+}
+
+// newTaskLog 创建任务日志, 任务结束前可以通过 TailLog 跟踪
+func (w *Worker) newTaskLog(jobID string, taskID uint64) *taskLog {
+	path, err := w.taskLogPath(jobID, taskID)
+	if err != nil {
+		// 非法的 jobID 不写入本地日志, 只保留 tail
+		xlog.Error("task log skipped", xlog.String("jobId", jobID), xlog.String("err", err.Error()))
+		path = ""
+	}
+	log := newTaskLog(path, w.LogMaxSize, w.LogMaxBackups, w.LogTail)
+	w.taskLogs.Store(taskLogKey{jobID: jobID, taskID: taskID}, log)
+	return log
+}
+
+// closeTaskLog 任务结束
+func (w *Worker) closeTaskLog(jobID string, taskID uint64, log *taskLog) {
+	w.taskLogs.Delete(taskLogKey{jobID: jobID, taskID: taskID})
+	if err := log.Close(); err != nil {
+		xlog.Error("close task log failed", xlog.String("path", log.path), xlog.String("err", err.Error()))
+	}
+}
+
+// TailLog 从 offset 开始输出任务的本地日志, offset 小于 0 时输出最后 -offset 字节
+// follow 为 true 且任务正在执行时, 持续输出新的内容直到任务结束或者 ctx 取消
+func (w *Worker) TailLog(ctx context.Context, jobID string, taskID uint64, offset int64, follow bool, out io.Writer) error {
+	path, err := w.taskLogPath(jobID, taskID)
+	if err != nil {
+		return err
+	}
+	var done <-chan struct{}
+	if value, ok := w.taskLogs.Load(taskLogKey{jobID: jobID, taskID: taskID}); ok && follow {
+		done = value.(*taskLog).done
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) || done == nil {
+			if os.IsNotExist(err) {
+				return ErrTaskLogNotFound
+			}
+			return err
+		}
+		// 任务已开始但还没有输出
+		file, err = waitLogFile(ctx, path, done)
+		if file == nil {
+			return err
+		}
+	}
+	defer func() { _ = file.Close() }()
+
+	if offset < 0 {
+		if _, err := file.Seek(offset, io.SeekEnd); err != nil {
+			_, _ = file.Seek(0, io.SeekStart)
+		}
+	} else if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, file); err != nil || done == nil {
+		return err
+	}
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		finished := false
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-done:
+			finished = true
+		case <-ticker.C:
+		}
+		if _, err := io.Copy(out, file); err != nil {
+			return err
+		}
+		// 日志滚动后读完旧文件, 按写入顺序继续读取之后的文件
+		for rotated(file, path) {
+			next := w.nextLogFile(file, path)
+			if next == nil {
+				break
+			}
+			if _, err := io.Copy(out, file); err != nil {
+				_ = next.Close()
+				return err
+			}
+			_ = file.Close()
+			file = next
+			if _, err := io.Copy(out, file); err != nil {
+				return err
+			}
+		}
+		if finished {
+			return nil
+		}
+	}
+}
+
+// waitLogFile 等待任务创建日志文件, 任务结束时仍没有输出返回 nil
+func waitLogFile(ctx context.Context, path string, done <-chan struct{}) (*os.File, error) {
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-done:
+			return nil, nil
+		case <-ticker.C:
+		}
+		file, err := os.Open(path)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// nextLogFile 返回滚动后在 file 之后写入的文件, file 已被删除时从最旧的文件继续
+func (w *Worker) nextLogFile(file *os.File, path string) *os.File {
+	opened, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+	backup := func(i int) string {
+		if i == 0 {
+			return path
+		}
+		return fmt.Sprintf("%s.%d", path, i)
+	}
+	next := -1
+	for i := 1; i <= w.LogMaxBackups; i++ {
+		if info, err := os.Stat(backup(i)); err == nil && os.SameFile(opened, info) {
+			next = i - 1
+			break
+		}
+	}
+	if next < 0 {
+		for next = w.LogMaxBackups; next > 0; next-- {
+			if _, err := os.Stat(backup(next)); err == nil {
+				break
+			}
+		}
+	}
+	f, err := os.Open(backup(next))
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+func rotated(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(opened, current)
+}
+
+// cleanTaskLogsLoop 定期清理任务日志, 不阻塞任务调度
+func (w *Worker) cleanTaskLogsLoop() {
+	w.cleanTaskLogs()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.cleanTaskLogs()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// cleanTaskLogs 删除超过 LogMaxAge 天未修改的任务日志, 执行中的任务的日志和目录不删除
+func (w *Worker) cleanTaskLogs() {
+	if w.LogMaxAge <= 0 {
+		return
+	}
+	deadline := time.Now().AddDate(0, 0, -w.LogMaxAge)
+	running := make(map[string]bool)
+	w.taskLogs.Range(func(key, _ interface{}) bool {
+		running[key.(taskLogKey).jobID] = true
+		return true
+	})
+	err := filepath.Walk(w.LogDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == w.LogDir {
+			return nil
+		}
+		if info.IsDir() {
+			if running[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.ModTime().Before(deadline) {
+			_ = os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		w.logger.Error("clean task logs failed", xlog.String("dir", w.LogDir), xlog.String("err", err.Error()))
+		return
+	}
+	// 删除超过期限的空任务目录, 目录中还有日志时删除失败
+	dirs, err := ioutil.ReadDir(w.LogDir)
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || running[dir.Name()] || !dir.ModTime().Before(deadline) {
+			continue
+		}
+		_ = os.Remove(filepath.Join(w.LogDir, dir.Name()))
+	}
+}
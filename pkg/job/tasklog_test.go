@@ -0,0 +1,119 @@
+package job
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer TailLog 在另一个goroutine中写入
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTaskLog_Tail(t *testing.T) {
+	w := &Worker{Config: &Config{LogDir: t.TempDir(), LogMaxSize: 16, LogMaxBackups: 1, LogTail: 8}}
+	log := w.newTaskLog("job-1", 1)
+	log.WriteString("0123456789")
+	log.WriteString("abcdef")
+
+	tail, changed := log.Tail()
+	assert.Equal(t, "89abcdef", tail)
+	assert.True(t, changed)
+	_, changed = log.Tail()
+	assert.False(t, changed)
+	assert.Equal(t, int64(16), log.Size())
+
+	// 输出最后 4 字节
+	var out strings.Builder
+	assert.Nil(t, w.TailLog(context.Background(), "job-1", 1, -4, false, &out))
+	assert.Equal(t, "cdef", out.String())
+
+	_, err := w.taskLogPath("../job", 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrTaskLogNotFound, w.TailLog(context.Background(), "job-1", 2, 0, false, &out))
+	w.closeTaskLog("job-1", 1, log)
+
+	// 非法的 jobID 不写入本地日志, 只保留 tail
+	log = w.newTaskLog("../job", 3)
+	log.WriteString("0123")
+	assert.Equal(t, "", log.path)
+	assert.Equal(t, "0123", log.String())
+	w.closeTaskLog("../job", 3, log)
+}
+
+func TestTaskLog_Follow(t *testing.T) {
+	w := &Worker{Config: &Config{LogDir: t.TempDir(), LogMaxSize: 8, LogMaxBackups: 2, LogTail: 8}}
+	log := w.newTaskLog("job-1", 1)
+	log.WriteString("line-1\n")
+
+	var (
+		out  syncBuffer
+		done = make(chan error)
+	)
+	go func() {
+		done <- w.TailLog(context.Background(), "job-1", 1, 0, true, &out)
+	}()
+	// 其他任务相同的 taskID 不跟踪
+	var other strings.Builder
+	assert.Equal(t, ErrTaskLogNotFound, w.TailLog(context.Background(), "job-2", 1, 0, true, &other))
+	for !strings.Contains(out.String(), "line-1") {
+		time.Sleep(time.Millisecond * 10)
+	}
+	// 写满后滚动, 跟踪的请求继续读取新文件
+	log.WriteString("line-2\n")
+	log.WriteString("line-3\n")
+	w.closeTaskLog("job-1", 1, log)
+
+	assert.Nil(t, <-done)
+	assert.Equal(t, "line-1\nline-2\nline-3\n", out.String())
+}
+
+func TestWorker_CleanTaskLogs(t *testing.T) {
+	dir := t.TempDir()
+	w := &Worker{Config: &Config{LogDir: dir, LogMaxAge: 1, LogMaxSize: 1024, LogTail: 8}}
+	old := time.Now().AddDate(0, 0, -2)
+	write := func(path string) {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte("log"), 0644))
+		assert.Nil(t, os.Chtimes(path, old, old))
+	}
+	write(filepath.Join(dir, "job-1", "1.log"))
+	write(filepath.Join(dir, "job-1", "2.log"))
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "job-1"), old, old))
+	// 执行中的任务
+	write(filepath.Join(dir, "job-2", "1.log"))
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "job-2"), old, old))
+	log := w.newTaskLog("job-2", 3)
+	// 即将写入日志的新目录
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "job-3"), 0755))
+
+	w.cleanTaskLogs()
+	_, err := os.Stat(filepath.Join(dir, "job-1", "1.log"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "job-2", "1.log"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "job-3"))
+	assert.Nil(t, err)
+	w.closeTaskLog("job-2", 3, log)
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/douyu/juno-agent/pkg/job/etcd"
 	"github.com/douyu/juno-agent/util"
@@ -42,8 +43,14 @@ type Worker struct {
 	jobs        Jobs // 和结点相关的任务
 	cmds        map[string]*Cmd
 	runningJobs map[string]context.CancelFunc
+	// 执行中任务的日志, taskLogKey -> *taskLog
+	taskLogs sync.Map
+	// 执行中的任务, taskID -> *Task
+	running sync.Map
 
 	done      chan struct{}
+	stopOnce  sync.Once
+	exited    chan struct{}
 	taskIdGen *sonyflake.Sonyflake
 }
 
@@ -56,6 +63,7 @@ func NewWorker(conf *Config) (w *Worker) {
 		cmds:           make(map[string]*Cmd),
 		runningJobs:    make(map[string]context.CancelFunc),
 		done:           make(chan struct{}),
+		exited:         make(chan struct{}),
 		taskIdGen:      sonyflake.NewSonyflake(sonyflake.Settings{}), // default setting
 	}
 
@@ -66,22 +74,29 @@ func NewWorker(conf *Config) (w *Worker) {
 	return
 }
 
+// Run 监听任务变化并调度, 直到 Stop
 func (w *Worker) Run() error {
+	defer close(w.exited)
 	w.logger.Info("Worker run...")
 
 	w.Cron.Run()
 
-	lockWCh := w.Client.Watch(context.Background(), LockKeyPrefix, clientv3.WithPrefix())
-	onceWch := w.Client.Watch(context.Background(), OnceKeyPrefix+w.HostName, clientv3.WithPrefix())
-	procWch := w.Client.Watch(context.Background(), ProcKeyPrefix, clientv3.WithPrefix())
-	jobWch, err := etcd.WatchPrefix(w.Client, context.Background(), JobsKeyPrefix)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lockWCh := w.Client.Watch(ctx, LockKeyPrefix, clientv3.WithPrefix())
+	onceWch := w.Client.Watch(ctx, OnceKeyPrefix+w.HostName, clientv3.WithPrefix())
+	procWch := w.Client.Watch(ctx, ProcKeyPrefix, clientv3.WithPrefix())
+	jobWch, err := etcd.WatchPrefix(w.Client, ctx, JobsKeyPrefix)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer jobWch.Close()
 
 	// load prev jobs
 	w.loadJobs(jobWch.IncipientKeyValues())
 
+	go w.cleanTaskLogsLoop()
+
 	for {
 		select {
 		case ev := <-lockWCh:
@@ -96,10 +111,29 @@ func (w *Worker) Run() error {
 		case ev := <-jobWch.C():
 			w.handleJobEv(ev)
 
+		case <-w.done:
+			return nil
 		}
 	}
+}
 
-	return nil
+// Stop 停止监听和调度, 释放任务锁, 等待正在执行的任务结束或者 ctx 超时
+func (w *Worker) Stop(ctx context.Context) error {
+	w.stopOnce.Do(func() {
+		close(w.done)
+	})
+	select {
+	case <-w.exited:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	w.CleanJobs()
+	select {
+	case <-w.Cron.Cron.Stop().Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (w *Worker) loadJobs(keyValue []*mvccpb.KeyValue) {
@@ -298,7 +332,13 @@ func (w *Worker) GetOnceJobFromKv(key []byte, value []byte) (*OnceJob, error) {
 	return job, nil
 }
 
+// KillExecutingProc 按任务的 KillPolicy 终止执行中的任务
 func (w *Worker) KillExecutingProc(process *Process) {
+	if value, ok := w.running.Load(process.TaskID); ok {
+		w.logger.Sugar().Infof("task[%d] of job[%s] is killed by request", process.TaskID, process.JobID)
+		value.(*Task).kill()
+		return
+	}
 	pid, _ := strconv.Atoi(process.ID)
 	if err := killProcess(pid); err != nil {
 		w.logger.Sugar().Warnf("process:[%d] force kill failed, error:[%s]", pid, err)
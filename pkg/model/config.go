@@ -0,0 +1,36 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// ConfigVersionsReq ...
+type ConfigVersionsReq struct {
+	Path string `query:"path"`
+}
+
+// ConfigRollbackReq ...
+type ConfigRollbackReq struct {
+	Path    string `json:"path"`
+	Version string `json:"version"` // 历史版本ID或MD5, 为空时回滚到上一个版本
+}
+
+// ConfigHistoryReq ...
+type ConfigHistoryReq struct {
+	Name  string `query:"name"`
+	Env   string `query:"env"`
+	File  string `query:"file"`
+	Start int64  `query:"start"` // 秒级时间戳
+	End   int64  `query:"end"`   // 秒级时间戳
+	Limit int    `query:"limit"` // 默认 100, 最大 1000
+}
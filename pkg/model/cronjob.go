@@ -0,0 +1,23 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// CronTaskLogReq ...
+type CronTaskLogReq struct {
+	JobID  string `query:"job_id"`
+	TaskID uint64 `query:"task_id"`
+	Offset int64  `query:"offset"` // 从该位置开始输出, 小于 0 时输出最后 -offset 字节
+	Follow bool   `query:"follow"` // 任务执行中时持续输出新的内容
+}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	parser "github.com/yangchenxing/go-nginx-conf-parser"
 )
@@ -34,6 +35,7 @@ type ConfScanner struct {
 	enable     bool
 	confDir    string
 	stop       chan struct{}
+	stopOnce   sync.Once
 	chanConfig chan *structs.NginxConfExt
 	watchPath  []string
 }
@@ -57,10 +59,16 @@ func (c *ConfScanner) Start() error {
 	return nil
 }
 
-// Close ...
+// Enabled ...
+func (c *ConfScanner) Enabled() bool {
+	return c.enable
+}
+
+// Close stop watching the conf dirs, C() is closed after the watch exits
 func (c *ConfScanner) Close() error {
-	c.stop <- struct{}{}
-	close(c.chanConfig)
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
 	return nil
 }
 
@@ -117,10 +125,13 @@ func (c *ConfScanner) watch() error {
 	for _, dir := range c.watchPath {
 		if err := w.Add(dir); err != nil {
 			xlog.Error("nginx fsnotify add dir err", xlog.String("msg", err.Error()), xlog.String("path", dir))
+			_ = w.Close()
 			return nil
 		}
 	}
 	go func() {
+		defer close(c.chanConfig)
+		defer w.Close()
 		for {
 			select {
 			case ev, ok := <-w.Events:
@@ -0,0 +1,175 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Plugin engine中的组件, 由 Registry 按注册顺序启动, 逆序停止
+type Plugin interface {
+	Name() string
+	// Start 启动组件, 未开启的组件直接返回 nil
+	Start(ctx context.Context) error
+	// Stop 停止组件启动的goroutine并释放资源, ctx 超时后 Registry 不再等待
+	Stop(ctx context.Context) error
+	Health() Health
+}
+
+// Health 组件状态, Name 和 Running 由 Registry 设置
+type Health struct {
+	Name    string      `json:"name"`
+	Enabled bool        `json:"enabled"`
+	Running bool        `json:"running"`
+	Healthy bool        `json:"healthy"`
+	Error   string      `json:"error"`
+	Detail  interface{} `json:"detail,omitempty"`
+}
+
+// ErrDuplicate 同名组件重复注册
+var ErrDuplicate = errors.New("plugin already registered")
+
+// Registry 组件注册表
+type Registry struct {
+	mu      sync.Mutex
+	plugins []Plugin
+	// 已启动的组件, 按启动顺序
+	started []Plugin
+}
+
+// NewRegistry ...
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register 注册组件, 启动顺序与注册顺序相同
+func (r *Registry) Register(plugins ...Plugin) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range plugins {
+		if r.lookup(p.Name()) != nil {
+			return fmt.Errorf("%w: %s", ErrDuplicate, p.Name())
+		}
+		r.plugins = append(r.plugins, p)
+	}
+	return nil
+}
+
+// Get ...
+func (r *Registry) Get(name string) (Plugin, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.lookup(name)
+	return p, p != nil
+}
+
+// Start 按注册顺序启动未启动的组件, 遇到错误时停止启动后续组件, 已启动的组件需要调用 Stop 停止
+func (r *Registry) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.plugins {
+		if r.running(p) {
+			continue
+		}
+		if err := p.Start(ctx); err != nil {
+			return fmt.Errorf("start plugin %s: %w", p.Name(), err)
+		}
+		r.started = append(r.started, p)
+		xlog.Info("plugin started", xlog.String("name", p.Name()))
+	}
+	return nil
+}
+
+// Stop 按启动的逆序停止全部组件, 单个组件失败或超时不影响其他组件, 返回第一个错误
+func (r *Registry) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	started := r.started
+	r.started = nil
+	r.mu.Unlock()
+
+	var first error
+	for i := len(started) - 1; i >= 0; i-- {
+		p := started[i]
+		if err := stop(ctx, p); err != nil {
+			xlog.Error("plugin stop error", xlog.String("name", p.Name()), xlog.String("err", err.Error()))
+			if first == nil {
+				first = fmt.Errorf("stop plugin %s: %w", p.Name(), err)
+			}
+			continue
+		}
+		xlog.Info("plugin stopped", xlog.String("name", p.Name()))
+	}
+	return first
+}
+
+// Health 按注册顺序返回全部组件的状态
+func (r *Registry) Health() []Health {
+	r.mu.Lock()
+	plugins := append([]Plugin(nil), r.plugins...)
+	running := make(map[string]bool, len(r.started))
+	for _, p := range r.started {
+		running[p.Name()] = true
+	}
+	r.mu.Unlock()
+
+	healths := make([]Health, 0, len(plugins))
+	for _, p := range plugins {
+		health := p.Health()
+		health.Name = p.Name()
+		health.Running = running[p.Name()]
+		if !health.Running {
+			health.Healthy = false
+		}
+		healths = append(healths, health)
+	}
+	return healths
+}
+
+func (r *Registry) lookup(name string) Plugin {
+	for _, p := range r.plugins {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (r *Registry) running(p Plugin) bool {
+	for _, s := range r.started {
+		if s == p {
+			return true
+		}
+	}
+	return false
+}
+
+// stop ctx 超时后不再等待组件停止
+func stop(ctx context.Context, p Plugin) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Stop(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+type fakePlugin struct {
+	name     string
+	events   *recorder
+	startErr error
+	stopErr  error
+	// 停止时阻塞, 直到 ctx 超时
+	block bool
+}
+
+func (p *fakePlugin) Name() string { return p.name }
+
+func (p *fakePlugin) Start(ctx context.Context) error {
+	p.events.add("start " + p.name)
+	return p.startErr
+}
+
+func (p *fakePlugin) Stop(ctx context.Context) error {
+	p.events.add("stop " + p.name)
+	if p.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return p.stopErr
+}
+
+func (p *fakePlugin) Health() Health { return Health{Enabled: true, Healthy: true} }
+
+func TestRegistry_Order(t *testing.T) {
+	events := &recorder{}
+	r := NewRegistry()
+	assert.Nil(t, r.Register(&fakePlugin{name: "a", events: events}, &fakePlugin{name: "b", events: events}))
+	assert.True(t, errors.Is(r.Register(&fakePlugin{name: "a", events: events}), ErrDuplicate))
+
+	assert.Nil(t, r.Start(context.Background()))
+	// 单个组件停止失败时继续停止其他组件
+	b, _ := r.Get("b")
+	b.(*fakePlugin).stopErr = errors.New("stop b")
+	assert.EqualError(t, r.Stop(context.Background()), "stop plugin b: stop b")
+	assert.Equal(t, []string{"start a", "start b", "stop b", "stop a"}, events.list())
+
+	health := r.Health()
+	assert.Len(t, health, 2)
+	assert.Equal(t, "a", health[0].Name)
+	assert.False(t, health[0].Running)
+	assert.False(t, health[0].Healthy)
+}
+
+func TestRegistry_StartError(t *testing.T) {
+	events := &recorder{}
+	r := NewRegistry()
+	assert.Nil(t, r.Register(
+		&fakePlugin{name: "a", events: events},
+		&fakePlugin{name: "b", events: events, startErr: errors.New("start b")},
+		&fakePlugin{name: "c", events: events},
+	))
+	assert.EqualError(t, r.Start(context.Background()), "start plugin b: start b")
+	assert.True(t, r.Health()[0].Running)
+	assert.False(t, r.Health()[1].Running)
+
+	// 只停止已启动的组件
+	assert.Nil(t, r.Stop(context.Background()))
+	assert.Equal(t, []string{"start a", "start b", "stop a"}, events.list())
+}
+
+func TestRegistry_StopTimeout(t *testing.T) {
+	events := &recorder{}
+	r := NewRegistry()
+	// b 最后停止, 超时后返回
+	assert.Nil(t, r.Register(&fakePlugin{name: "b", events: events, block: true}, &fakePlugin{name: "a", events: events}))
+	assert.Nil(t, r.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := r.Stop(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, []string{"start b", "start a", "stop a", "stop b"}, events.list())
+}
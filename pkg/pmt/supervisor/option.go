@@ -71,6 +71,7 @@ func (c *Config) Build() *Scanner {
 	return &Scanner{
 		enable:      c.Enable,
 		confDir:     c.Dir,
+		stop:        make(chan struct{}),
 		chanProgram: make(chan *ProgramExt, 1000),
 	}
 }
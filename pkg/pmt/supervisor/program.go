@@ -36,6 +36,7 @@ type Program struct {
 	StderrLogfileBackups  int    `ini:"stderr_logfile_backups"`
 	Stopsignal            string `ini:"stopsignal"`
 	Config                string `ini:"-"`
+	Name                  string `ini:"-"` // program name in section [program:xxx]
 }
 
 // ProgramExt ...
@@ -52,11 +53,11 @@ type ProgramExt struct {
 // Unwrap ...
 func (program *ProgramExt) Unwrap() *structs.ProgramExt {
 	return &structs.ProgramExt{
-		FileName: program.FileName,
-		FilePath: program.FilePath,
-		Manager:  "supervisor",
-		Status:   program.Status,
-		// ProgramName:  program.Unit.Description,
+		FileName:    program.FileName,
+		FilePath:    program.FilePath,
+		Manager:     "supervisor",
+		Status:      program.Status,
+		ProgramName: program.Name,
 		// StartCommand: program.ExecStart,
 		// Environments: program.Environments,
 		User: program.User,
@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // Scanner supervisor sacnner
@@ -32,6 +33,7 @@ type Scanner struct {
 	enable      bool
 	confDir     string // conf文件路径
 	stop        chan struct{}
+	stopOnce    sync.Once
 	chanProgram chan *ProgramExt
 }
 
@@ -58,6 +60,19 @@ func (s *Scanner) Start() error {
 	return nil
 }
 
+// Enabled ...
+func (s *Scanner) Enabled() bool {
+	return s.enable
+}
+
+// Close stop watching the conf dir, C() is closed after the watch exits
+func (s *Scanner) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
+}
+
 // parseFile parse supervisor file
 func (s *Scanner) parseFile(file string) (*Program, []byte, error) {
 	content, err := ioutil.ReadFile(file)
@@ -80,6 +95,7 @@ func (s *Scanner) parse(content []byte) (*Program, error) {
 		if section.Name() != ini.DEFAULT_SECTION {
 			program := new(Program)
 			err = section.MapTo(program)
+			program.Name = strings.TrimPrefix(section.Name(), "program:")
 			if program.Command != "" {
 				kvs := strings.SplitN(program.Command, " ", -1)
 				for _, val := range kvs {
@@ -144,10 +160,13 @@ func (s *Scanner) startWatch() error {
 	}
 	if err := w.Add(s.confDir); err != nil {
 		xlog.Error("fsnotify add dir err", xlog.String("msg", err.Error()))
+		_ = w.Close()
 		return nil
 	}
 
 	go func() {
+		defer close(s.chanProgram)
+		defer w.Close()
 		for {
 			select {
 			case ev, ok := <-w.Events:
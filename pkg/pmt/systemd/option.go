@@ -60,5 +60,6 @@ func (s *Config) Build() *Scanner {
 		enable:      s.Enable,
 		confDir:     s.Dir,
 		chanProgram: make(chan *ProgramExt, 1000),
+		stop:        make(chan struct{}),
 	}
 }
@@ -88,5 +88,6 @@ func (program *ProgramExt) Unwrap() *structs.ProgramExt {
 		RestartSec:   5, // to parse
 		ConfData:     program.Content,
 		Config:       program.Config,
+		ExecReload:   program.ExecReload,
 	}
 }
@@ -36,6 +36,7 @@ type Scanner struct {
 	confDir     string
 	chanProgram chan *ProgramExt
 	stop        chan struct{}
+	stopOnce    sync.Once
 }
 
 // Start start watch
@@ -46,9 +47,16 @@ func (s *Scanner) Start() error {
 	return nil
 }
 
-// Close close ...
+// Enabled ...
+func (s *Scanner) Enabled() bool {
+	return s.enable
+}
+
+// Close stop watching the conf dir, C() is closed after the watch exits
 func (s *Scanner) Close() error {
-	s.stop <- struct{}{}
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
 	return nil
 }
 
@@ -152,9 +160,12 @@ func (s *Scanner) startWatch() error {
 	err = w.Add(s.confDir)
 	if err != nil {
 		xlog.Error("SystemdScanner add dir err", xlog.String("err", err.Error()))
+		_ = w.Close()
 		return nil
 	}
 	go func() {
+		defer close(s.chanProgram)
+		defer w.Close()
 		for {
 			select {
 			case ev, ok := <-w.Events:
@@ -17,6 +17,7 @@ package process
 import (
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/douyu/juno-agent/pkg/structs"
@@ -28,6 +29,7 @@ type Scanner struct {
 	enable        bool
 	chanProcesses chan []structs.ProcessStatus
 	stop          chan struct{}
+	stopOnce      sync.Once
 }
 
 // Start after a delay of the specified time,
@@ -42,10 +44,16 @@ func (ps *Scanner) C() <-chan []structs.ProcessStatus {
 	return ps.chanProcesses
 }
 
-// Close ...
+// Enabled ...
+func (ps *Scanner) Enabled() bool {
+	return ps.enable
+}
+
+// Close stop the monitor, C() is closed after the monitor exits
 func (ps *Scanner) Close() error {
-	ps.stop <- struct{}{}
-	close(ps.chanProcesses)
+	ps.stopOnce.Do(func() {
+		close(ps.stop)
+	})
 	return nil
 }
 
@@ -90,12 +98,13 @@ func (ps *Scanner) scan() ([]structs.ProcessStatus, error) {
 }
 
 // GetProcessStatus ...
-func (ps Scanner) GetProcessStatus() ([]structs.ProcessStatus, error) {
+func (ps *Scanner) GetProcessStatus() ([]structs.ProcessStatus, error) {
 	return ps.scan()
 }
 
 // monitor Periodically monitor the process status and write to the channel
 func (ps *Scanner) monitor() {
+	defer close(ps.chanProcesses)
 	var ticker = time.NewTicker(time.Second * 10)
 	defer ticker.Stop()
 	for {
@@ -106,7 +115,11 @@ func (ps *Scanner) monitor() {
 				// log.Errord("scan process")
 				continue
 			}
-			ps.chanProcesses <- processes
+			select {
+			case ps.chanProcesses <- processes:
+			case <-ps.stop:
+				return
+			}
 		case <-ps.stop:
 			return
 		}
@@ -0,0 +1,427 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applier
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/audit"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/cache"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/drift"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/hook"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/keyring"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/render"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/validator"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/writer"
+	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Store 数据源的读取接口, 由 etcd/mysql 数据源实现
+type Store interface {
+	// Get 按key精确查询, 返回 key -> value
+	Get(keys ...string) (map[string]string, error)
+	// List 查询前缀下的全部配置, 返回 key -> value
+	List(prefix string) (map[string]string, error)
+}
+
+// Reporter 上报配置下发状态, 控制台通过上报的结果展示配置是否生效
+type Reporter interface {
+	Report(confKey structs.ConfKey, report structs.ConfReport) error
+}
+
+// KeyValue 数据源中的一条配置
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Config 配置下发使用的组件, 与数据源无关
+type Config struct {
+	Prefix string
+	// agent处理的配置环境
+	Env structs.EnvFilter
+	// 本地缓存, 数据源不可用时兜底
+	Cache *cache.Cache
+	// 配置文件写入
+	Writer *writer.Writer
+	// 配置文件写入后执行的动作
+	Hooks *hook.Hooks
+	// 解密加密的配置内容
+	Keys *keyring.Ring
+	// 渲染模板配置
+	Renderer *render.Renderer
+	// 检查已写入的配置文件是否被修改
+	Drift *drift.Detector
+	// 配置下发审计记录
+	Audit *audit.Log
+	// 上报配置下发状态, 为空时不上报
+	Reporter Reporter
+}
+
+// Applier 数据源共用的配置下发流程: 校验、解密、渲染、写入、执行动作、上报以及通知监听
+// 数据源只负责获取配置和监听变化
+type Applier struct {
+	Config
+	store Store
+
+	// 用于记录长轮训的应用信息
+	jm list.List // *configNode
+	mu sync.Mutex
+}
+
+// New ...
+func New(config Config, store Store) *Applier {
+	applier := &Applier{
+		Config: config,
+		store:  store,
+	}
+	config.Drift.SetCallback(applier.reportDrift)
+	return applier
+}
+
+// HostKey 本机配置的前缀
+func (a *Applier) HostKey() string {
+	return strings.Join([]string{a.Prefix, report.ReturnHostName()}, "/") + "/"
+}
+
+// Put 下发一条配置, 记录审计、上报下发状态并通知监听, 返回下发的错误
+func (a *Applier) Put(trigger, key, value string) (*structs.ConfNode, error) {
+	confuNode, apply, err := a.update(key, value)
+	a.Audit.Record(trigger, key, value, apply, err)
+	if err != nil {
+		if errors.Is(err, structs.ErrEnvPass) {
+			xlog.Info("confProxy update env pass", xlog.String("trigger", trigger), xlog.String("key", key))
+		} else {
+			xlog.Error("confProxy update error", xlog.String("trigger", trigger), xlog.String("key", key), xlog.String("err", err.Error()))
+		}
+	} else {
+		commonKey := util.GetConfigKey(confuNode.AppName, confuNode.AppEnvi, confuNode.FileName, confuNode.Port)
+		a.broadcast(commonKey, key, confuNode)
+		a.putCache(key, value)
+		xlog.Info("confProxy update success", xlog.String("trigger", trigger), xlog.String("key", key), xlog.Any("paths", apply.Paths))
+	}
+	if rr := a.report(key, value, apply, err); rr != nil {
+		xlog.Error("confProxy report error", xlog.String("key", key), xlog.String("err", rr.Error()))
+	}
+	if err == nil {
+		a.runHooks(key, value, apply)
+	}
+	return confuNode, err
+}
+
+// runHooks 内容有变化的配置文件, 异步通知使用该配置的程序, 完成后上报带有动作结果的下发状态
+func (a *Applier) runHooks(key, value string, apply structs.ConfApply) {
+	a.Hooks.Run(apply.Changed, func(results []structs.ConfHookResult) {
+		// 动作执行期间配置已经更新或下线, 不再上报旧版本的结果
+		if a.Cache != nil {
+			if entry, err := a.Cache.Get(key); err != nil || entry.Value != value {
+				return
+			}
+		}
+		apply.Hooks = results
+		if err := a.report(key, value, apply, nil); err != nil {
+			xlog.Error("confProxy report error", xlog.String("key", key), xlog.String("err", err.Error()))
+		}
+	})
+}
+
+// Delete 配置下线, 按照删除策略处理已写入的文件, 通知监听配置已下线
+// prevValue 为数据源提供的下线前的配置, 本地缓存中没有该配置时使用, 没有时传空
+func (a *Applier) Delete(trigger, key, prevValue string) error {
+	confuNode, value, apply, err := a.remove(key, prevValue)
+	a.Audit.Record(trigger, key, value, apply, err)
+	if err != nil {
+		xlog.Error("confProxy delete error", xlog.String("trigger", trigger), xlog.String("key", key), xlog.String("err", err.Error()))
+	} else {
+		// 通知长轮训的客户端配置已下线
+		commonKey := util.GetConfigKey(confuNode.AppName, confuNode.AppEnvi, confuNode.FileName, confuNode.Port)
+		a.broadcast(commonKey, key, confuNode)
+		xlog.Info("confProxy delete success", xlog.String("trigger", trigger), xlog.String("key", key), xlog.Any("paths", apply.Paths))
+	}
+	if rr := a.report(key, value, apply, err); rr != nil {
+		xlog.Error("confProxy report error", xlog.String("key", key), xlog.String("err", rr.Error()))
+	}
+	return err
+}
+
+// Sync 下发全量加载的本机配置, 并下线数据源中已经不存在的配置, 返回下发成功的配置节点
+func (a *Applier) Sync(trigger string, kvs []KeyValue) []*structs.ConfNode {
+	confuNodes := make([]*structs.ConfNode, 0, len(kvs))
+	keys := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		keys = append(keys, kv.Key)
+		if confuNode, err := a.Put(trigger, kv.Key, kv.Value); err == nil {
+			confuNodes = append(confuNodes, confuNode)
+		}
+	}
+	a.Prune(trigger, keys)
+	return confuNodes
+}
+
+// Prune 下线本地缓存中存在、但数据源中已经不存在的本机配置, keys 为数据源中本机的全部key
+// 用于无法监听到删除事件的场景, 如mysql轮询或者etcd的revision被压缩
+func (a *Applier) Prune(trigger string, keys []string) {
+	if a.Cache == nil {
+		return
+	}
+	exists := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		exists[key] = struct{}{}
+	}
+	for _, entry := range a.Cache.List(a.HostKey()) {
+		if _, ok := exists[entry.Key]; !ok {
+			_ = a.Delete(trigger, entry.Key, entry.Value)
+		}
+	}
+}
+
+// Close 数据源停止时关闭上报使用的连接
+func (a *Applier) Close() {
+	if closer, ok := a.Reporter.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			xlog.Error("confProxy reporter close error", xlog.String("err", err.Error()))
+		}
+	}
+}
+
+// Cached 数据源不可用时从本地缓存还原本机的配置节点
+func (a *Applier) Cached() []*structs.ConfNode {
+	return a.Env.Filter(a.Cache.ConfNodes(a.HostKey()))
+}
+
+// update 更新本地文件, 返回已写入的文件路径以及写入后执行动作的结果
+// 失败时返回 *structs.ConfApplyError, 用于上报下发状态
+func (a *Applier) update(key, value string) (*structs.ConfNode, structs.ConfApply, error) {
+	confNode := &structs.ConfNode{}
+	apply := structs.ConfApply{Paths: make([]string, 0)}
+	// key check
+	confuKeys, err := structs.ParserConfKey(key)
+	if err != nil {
+		return confNode, apply, structs.NewConfApplyError(structs.ConfStatusValidationFailed, err)
+	}
+	if err := confuKeys.CheckValid(); err != nil {
+		return confNode, apply, structs.NewConfApplyError(structs.ConfStatusValidationFailed, fmt.Errorf("key check: %s", err.Error()))
+	}
+	// env check: 只处理agent配置的环境
+	if err := a.Env.Check(confuKeys.EnvName); err != nil {
+		return confNode, apply, structs.NewConfApplyError(structs.ConfStatusEnvSkipped, err)
+	}
+	xlog.Debug("file update content", xlog.String("plugin", "confgo"), xlog.Any("confuKeys", confuKeys), xlog.String("key", key), xlog.String("value", value))
+
+	// value check
+	confuValue, err := structs.ParserConfValue(value)
+	if err != nil {
+		return confNode, apply, structs.NewConfApplyError(structs.ConfStatusValidationFailed, err)
+	}
+	if err := confuValue.CheckValid(); err != nil {
+		return confNode, apply, structs.NewConfApplyError(structs.ConfStatusValidationFailed, fmt.Errorf("value check: %s", err.Error()))
+	}
+	checksum := confuValue.Metadata.Version
+	if (confuValue.Metadata.Encoded || confuValue.Metadata.Template) && checksum == util.MD5(confuValue.Content) {
+		// 版本为密文或模板的MD5时, 下发内容已经校验通过, 写入时不再校验解密或渲染后的内容
+		checksum = ""
+	}
+	// decrypt: 解密后的内容不能输出到日志
+	if err := a.Keys.Decrypt(&confuValue); err != nil {
+		return confNode, apply, structs.NewConfApplyError(structs.ConfStatusDecryptFailed, err)
+	}
+	// render: 使用本机信息渲染模板配置
+	if err := a.Renderer.Render(&confuValue, render.HostFacts(confuKeys)); err != nil {
+		return confNode, apply, structs.NewConfApplyError(structs.ConfStatusRenderFailed, err)
+	}
+	// content check: 按照格式解析配置内容, 解析失败的配置不写入磁盘
+	if err := validator.Validate(confuValue.Metadata.Format, confuValue.Content); err != nil {
+		return confNode, apply, structs.NewConfApplyError(structs.ConfStatusValidationFailed, err)
+	}
+
+	// write file: 原子写入并校验MD5, 任意文件失败时全部恢复原内容
+	var changed []string
+	err = a.Drift.Write(key, confuValue.Metadata.Version, confuValue.Content, confuValue.Metadata.Paths, func() (err error) {
+		changed, err = a.Writer.WriteAll(confuValue.Metadata.Paths, confuValue.Content, checksum)
+		return err
+	})
+	if err != nil {
+		return confNode, apply, structs.NewConfApplyError(structs.ConfStatusWriteFailed, err)
+	}
+	apply.Paths = append(apply.Paths, confuValue.Metadata.Paths...)
+	apply.Changed = changed
+
+	return confuValue.ConfNode(confuKeys), apply, nil
+}
+
+// remove 配置下线, 按照删除策略处理已写入的文件, 返回下线前的配置
+// 删除事件不一定包含value, 配置的写入路径优先从本地缓存中获取, 缓存中没有时使用 prevValue
+func (a *Applier) remove(key, prevValue string) (*structs.ConfNode, string, structs.ConfApply, error) {
+	apply := structs.ConfApply{Paths: make([]string, 0), Deleted: true}
+	confuKeys, err := structs.ParserConfKey(key)
+	if err != nil {
+		return nil, prevValue, apply, structs.NewConfApplyError(structs.ConfStatusValidationFailed, err)
+	}
+	if err := a.Env.Check(confuKeys.EnvName); err != nil {
+		return nil, prevValue, apply, structs.NewConfApplyError(structs.ConfStatusEnvSkipped, err)
+	}
+	confNode := &structs.ConfNode{
+		AppName:  confuKeys.AppName,
+		AppEnvi:  confuKeys.EnvName,
+		FileName: confuKeys.FileName,
+		Port:     confuKeys.Port,
+		Deleted:  true,
+	}
+	entry := &cache.Entry{Key: key, Value: prevValue}
+	if a.Cache != nil {
+		if cached, err := a.Cache.Get(key); err == nil {
+			entry = cached
+		}
+	}
+	if entry.Value == "" {
+		// 不知道写入过哪些文件, 不能视为下线成功
+		return confNode, "", apply, structs.NewConfApplyError(structs.ConfStatusNotCached, fmt.Errorf("config %s is not cached", key))
+	}
+	confuValue, err := entry.ConfValue()
+	if err != nil {
+		return confNode, entry.Value, apply, structs.NewConfApplyError(structs.ConfStatusValidationFailed, err)
+	}
+	err = a.Drift.Remove(confuValue.Metadata.Paths, func() error {
+		for _, path := range confuValue.Metadata.Paths {
+			removed, err := a.Writer.Delete(path)
+			if err != nil {
+				return fmt.Errorf("delete %s: %w", path, err)
+			}
+			if removed {
+				apply.Paths = append(apply.Paths, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return confNode, entry.Value, apply, structs.NewConfApplyError(structs.ConfStatusWriteFailed, err)
+	}
+	if a.Cache == nil {
+		return confNode, entry.Value, apply, nil
+	}
+	if err := a.Cache.Delete(key); err != nil {
+		xlog.Error("confProxy cache delete error", xlog.String("key", key), xlog.String("err", err.Error()))
+	}
+	return confNode, entry.Value, apply, nil
+}
+
+// report 上报配置下发状态, applyErr 为 update 返回的错误
+func (a *Applier) report(key, value string, apply structs.ConfApply, applyErr error) error {
+	if a.Reporter == nil {
+		return nil
+	}
+	confuKeys, err := structs.ParserConfKey(key)
+	if err != nil {
+		return err
+	}
+	// value 解析失败时同样需要上报
+	confuValue, _ := structs.ParserConfValue(value)
+	reportValue := structs.ConfReport{
+		FileName:   confuKeys.FileName,
+		MD5:        confuValue.Metadata.Version,
+		Hostname:   confuKeys.Hostname,
+		Env:        confuKeys.EnvName,
+		Timestamp:  time.Now().Unix(),
+		HealthPort: confuKeys.Port,
+		Status:     structs.ConfApplyStatus(applyErr),
+		Paths:      apply.Paths,
+		Checksum:   fileChecksum(apply.Paths),
+		Hooks:      apply.Hooks,
+	}
+	if applyErr != nil {
+		reportValue.Error = applyErr.Error()
+	} else if apply.Deleted {
+		reportValue.Status = structs.ConfStatusDeleted
+	}
+	var parseErr *validator.ParseError
+	if errors.As(applyErr, &parseErr) {
+		reportValue.Line, reportValue.Column = parseErr.Line, parseErr.Column
+	}
+	return a.Reporter.Report(confuKeys, reportValue)
+}
+
+// reportDrift 上报配置文件与最后一次下发的内容不一致, 恢复后对使用该配置的程序执行动作
+func (a *Applier) reportDrift(drift structs.ConfDrift) {
+	reportValue := structs.ConfReport{
+		MD5:       drift.Version,
+		Timestamp: drift.DetectedAt,
+		Status:    structs.ConfStatusDrifted,
+		Error:     drift.Error,
+		Paths:     []string{drift.Path},
+		Checksum:  drift.Actual,
+	}
+	if drift.Healed {
+		a.Audit.RecordHeal(drift)
+		reportValue.Status = structs.ConfStatusHealed
+		reportValue.Checksum = drift.Expected
+	}
+	a.sendDrift(drift.Key, reportValue)
+	if drift.Healed {
+		a.Hooks.Run(reportValue.Paths, func(results []structs.ConfHookResult) {
+			reportValue.Hooks = results
+			a.sendDrift(drift.Key, reportValue)
+		})
+	}
+}
+
+// sendDrift 上报配置文件的不一致状态
+func (a *Applier) sendDrift(key string, reportValue structs.ConfReport) {
+	if a.Reporter == nil {
+		return
+	}
+	confuKeys, err := structs.ParserConfKey(key)
+	if err != nil {
+		return
+	}
+	reportValue.FileName = confuKeys.FileName
+	reportValue.Hostname = confuKeys.Hostname
+	reportValue.Env = confuKeys.EnvName
+	reportValue.HealthPort = confuKeys.Port
+	if err := a.Reporter.Report(confuKeys, reportValue); err != nil {
+		xlog.Error("drift report error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("key", key))
+	}
+}
+
+// putCache 将配置写入本地缓存
+func (a *Applier) putCache(key, value string) {
+	if a.Cache == nil {
+		return
+	}
+	if err := a.Cache.Put(key, value); err != nil {
+		xlog.Error("confProxy cache put error", xlog.String("key", key), xlog.String("err", err.Error()))
+	}
+}
+
+// fileChecksum 返回已写入文件在磁盘上的MD5
+func fileChecksum(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	content, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		return ""
+	}
+	return util.MD5(string(content))
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applier
+
+import (
+	"container/list"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/labstack/echo/v4"
+)
+
+// configNode 长轮训或订阅的监听
+type configNode struct {
+	key string
+	ch  chan *structs.ConfNode
+	// 订阅的监听在通知后不会关闭, 用于推送配置变化
+	subscribe bool
+}
+
+// ListenAppConfig listen the app config change
+func (a *Applier) ListenAppConfig(ctx echo.Context, key string) chan *structs.ConfNode {
+	xlog.Info("confProxy", xlog.String("listenConfig", key))
+	node := &configNode{
+		key: key,
+		ch:  make(chan *structs.ConfNode, 1),
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.jm.PushBack(node)
+	return node.ch
+}
+
+// Subscribe 订阅配置变化, 每次变化都会通知到 ch, 通过 RemoveListener 取消订阅
+func (a *Applier) Subscribe(key string, ch chan *structs.ConfNode) {
+	xlog.Info("confProxy", xlog.String("subscribeConfig", key))
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.jm.PushBack(&configNode{key: key, ch: ch, subscribe: true})
+}
+
+// RemoveListener 长轮训结束或取消订阅时移除监听
+func (a *Applier) RemoveListener(key string, ch chan *structs.ConfNode) {
+	var n *list.Element
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for item := a.jm.Front(); nil != item; item = n {
+		n = item.Next()
+		if node := item.Value.(*configNode); node.key == key && node.ch == ch {
+			a.jm.Remove(item)
+			return
+		}
+	}
+}
+
+// broadcast 配置变化后通知 key 或 rawKey 的监听, 长轮训的监听通知后移除
+func (a *Applier) broadcast(key, rawKey string, val *structs.ConfNode) {
+	var n *list.Element
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for item := a.jm.Front(); nil != item; item = n {
+		node := item.Value.(*configNode)
+		n = item.Next()
+		if node.key == key || node.key == rawKey {
+			if node.subscribe {
+				notify(node.ch, val)
+				continue
+			}
+			select {
+			case node.ch <- val:
+			default:
+			}
+			close(node.ch)
+			a.jm.Remove(item)
+		}
+	}
+}
+
+// notify 通知订阅者, 订阅者处理不及时丢弃最旧的通知, 保证最新的配置能够送达
+func notify(ch chan *structs.ConfNode, val *structs.ConfNode) {
+	for {
+		select {
+		case ch <- val:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
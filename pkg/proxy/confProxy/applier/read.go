@@ -0,0 +1,237 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applier
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/render"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/validator"
+	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrNotFound 数据源中没有找到配置
+var ErrNotFound = errors.New("no config is found")
+
+// GetValues ...
+func (a *Applier) GetValues(ctx echo.Context, keys ...string) (map[string]structs.ConfValue, error) {
+	var (
+		appName, appEnv, target, port = keys[0], keys[1], keys[2], keys[3]
+		res                           = make(map[string]structs.ConfValue)
+	)
+	portInt, err := strconv.Atoi(port)
+	if err != nil || portInt <= 0 {
+		return res, errors.New("wrong port")
+	}
+	if appName == "" || appEnv == "" {
+		return res, errors.New("invalid param")
+	}
+	if err := a.Env.Check(appEnv); err != nil {
+		return res, err
+	}
+
+	// 按 host -> zone -> region -> cluster 的顺序查找
+	zoneCode, _ := report.ReturnZone()
+	regionCode, _ := report.ReturnRegion()
+	scopes := structs.ConfScopes(report.ReturnHostName(), zoneCode, regionCode)
+	scopeKeys := make([]string, 0, len(scopes))
+	for i := len(scopes) - 1; i >= 0; i-- {
+		scopeKeys = append(scopeKeys, structs.ScopeKey(a.Prefix, scopes[i], appName, appEnv, target, strconv.Itoa(portInt)))
+	}
+	commonKey := util.GetConfigKey(appName, appEnv, target, port)
+	data, err := a.store.Get(scopeKeys...)
+	if err != nil {
+		xlog.Warn("getAppConfigContent fallback to local cache", xlog.String("hostKey", scopeKeys[0]), xlog.String("err", err.Error()))
+		return a.fallback(commonKey, err, scopeKeys...)
+	}
+	for i, key := range scopeKeys {
+		value, ok := data[key]
+		if !ok {
+			continue
+		}
+		config, err := structs.ParserConfValue(value)
+		if err != nil {
+			continue
+		}
+		if err := a.Keys.Decrypt(&config); err != nil {
+			return res, err
+		}
+		if err := a.renderValue(key, &config); err != nil {
+			return res, err
+		}
+		if err := validator.Validate(config.Metadata.Format, config.Content); err != nil {
+			return res, err
+		}
+		config.Scope = scopes[len(scopes)-1-i]
+		res[commonKey] = config
+		return res, nil
+	}
+
+	xlog.Info("getAppConfigContent", xlog.Any("keys", scopeKeys), xlog.Any("data", data))
+	return res, ErrNotFound
+}
+
+// GetRawValues ...
+func (a *Applier) GetRawValues(ctx echo.Context, rawKey string) (map[string]structs.ConfValue, error) {
+	res := make(map[string]structs.ConfValue)
+	if err := a.checkKey(rawKey); err != nil {
+		return res, err
+	}
+	data, err := a.store.Get(rawKey)
+	if err != nil {
+		xlog.Warn("getAppConfigContent fallback to local cache", xlog.String("rawKey", rawKey), xlog.String("err", err.Error()))
+		return a.fallback(rawKey, err, rawKey)
+	}
+	if value, ok := data[rawKey]; ok {
+		if config, err := structs.ParserConfValue(value); err == nil {
+			if err := a.Keys.Decrypt(&config); err != nil {
+				return res, err
+			}
+			if err := a.renderValue(rawKey, &config); err != nil {
+				return res, err
+			}
+			if err := validator.Validate(config.Metadata.Format, config.Content); err != nil {
+				return res, err
+			}
+			config.Scope = scopeOf(a.Prefix, rawKey)
+			res[rawKey] = config
+			return res, nil
+		}
+	}
+	xlog.Info("getAppConfigContent", xlog.String("rawKey", rawKey), xlog.Any("data", data))
+	return res, ErrNotFound
+}
+
+// GetLayers 返回应用在本机各个范围下发的全部配置文件
+func (a *Applier) GetLayers(ctx echo.Context, appName, appEnv string) ([]structs.ConfLayer, error) {
+	if appName == "" || appEnv == "" {
+		return nil, errors.New("invalid param")
+	}
+	if err := a.Env.Check(appEnv); err != nil {
+		return nil, err
+	}
+	zoneCode, _ := report.ReturnZone()
+	regionCode, _ := report.ReturnRegion()
+	prefixes := make([]string, 0)
+	for _, scope := range structs.ConfScopes(report.ReturnHostName(), zoneCode, regionCode) {
+		prefixes = append(prefixes, structs.ScopePrefix(a.Prefix, scope, appName, appEnv))
+	}
+	data := make(map[string]string)
+	for _, prefix := range prefixes {
+		values, err := a.store.List(prefix)
+		if err != nil {
+			xlog.Warn("getLayers fallback to local cache", xlog.String("prefix", prefix), xlog.String("err", err.Error()))
+			data, err = a.Cache.FallbackPrefix(err, prefixes...)
+			layers, layerErr := a.layers(data)
+			if layerErr != nil {
+				return nil, layerErr
+			}
+			return layers, err
+		}
+		for key, value := range values {
+			data[key] = value
+		}
+	}
+	return a.layers(data)
+}
+
+// layers 解析并解密各个范围的配置
+func (a *Applier) layers(data map[string]string) ([]structs.ConfLayer, error) {
+	layers := make([]structs.ConfLayer, 0, len(data))
+	for key, value := range data {
+		layer, err := structs.ParserConfLayer(a.Prefix, key)
+		if err != nil {
+			continue
+		}
+		if layer.Value, err = structs.ParserConfValue(value); err != nil {
+			continue
+		}
+		layer.Value.Scope = layer.Scope
+		if err := a.Keys.Decrypt(&layer.Value); err != nil {
+			return nil, err
+		}
+		if err := a.renderValue(key, &layer.Value); err != nil {
+			return nil, err
+		}
+		if err := validator.Validate(layer.Value.Metadata.Format, layer.Value.Content); err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// fallback 从本地缓存获取配置, 缓存中保存的是配置中心下发的原始内容, 需要解密
+// 读取接口不写入缓存, 缓存中只有本机已下发的配置
+func (a *Applier) fallback(resKey string, cause error, keys ...string) (map[string]structs.ConfValue, error) {
+	res, err := a.Cache.Fallback(resKey, cause, keys...)
+	if value, ok := res[resKey]; ok {
+		if rr := a.Keys.Decrypt(&value); rr != nil {
+			return map[string]structs.ConfValue{}, rr
+		}
+		// 缓存命中的key决定配置所在的范围
+		for _, key := range keys {
+			if _, rr := a.Cache.Get(key); rr == nil {
+				if rr := a.renderValue(key, &value); rr != nil {
+					return map[string]structs.ConfValue{}, rr
+				}
+				value.Scope = scopeOf(a.Prefix, key)
+				break
+			}
+		}
+		res[resKey] = value
+	}
+	return res, err
+}
+
+// renderValue 与写入文件时一样使用本机信息渲染模板配置, 读取接口返回的内容与磁盘上的文件一致
+func (a *Applier) renderValue(key string, value *structs.ConfValue) error {
+	if !value.Metadata.Template {
+		return nil
+	}
+	layer, err := structs.ParserConfLayer(a.Prefix, key)
+	if err != nil {
+		return err
+	}
+	return a.Renderer.Render(value, render.HostFacts(structs.ConfKey{
+		AppName:  layer.AppName,
+		EnvName:  layer.EnvName,
+		FileName: layer.FileName,
+		Port:     layer.Port,
+	}))
+}
+
+// checkKey 原生key需要在配置的前缀下, 并且环境在agent处理范围内
+func (a *Applier) checkKey(key string) error {
+	layer, err := structs.ParserConfLayer(a.Prefix, key)
+	if err != nil {
+		return err
+	}
+	return a.Env.Check(layer.EnvName)
+}
+
+// scopeOf 返回配置key所在的范围
+func scopeOf(prefix, key string) string {
+	layer, err := structs.ParserConfLayer(prefix, key)
+	if err != nil {
+		return ""
+	}
+	return layer.Scope
+}
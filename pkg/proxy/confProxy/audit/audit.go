@@ -0,0 +1,285 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	// DefaultMaxSize 单个审计文件的默认大小, 单位MB
+	DefaultMaxSize = 10
+	// DefaultMaxBackups 默认保留的滚动文件数量
+	DefaultMaxBackups = 5
+	// DefaultLimit 查询默认返回的记录数量
+	DefaultLimit = 100
+	// MaxLimit 查询最多返回的记录数量
+	MaxLimit = 1000
+
+	fileName   = "audit.log"
+	maxLineLen = 1 << 20
+)
+
+// Config 配置下发审计记录
+type Config struct {
+	Enable     bool `json:"enable"`
+	MaxSize    int  `json:"maxSize"`    // 单个文件大小, 单位MB, 默认 10
+	MaxBackups int  `json:"maxBackups"` // 滚动保留的文件数量, 默认 5
+}
+
+// Query 查询条件, 为空的条件不过滤
+type Query struct {
+	App   string
+	Env   string
+	File  string
+	Start int64 // 秒级时间戳
+	End   int64 // 秒级时间戳
+	Limit int   // 默认 100, 最大 1000
+}
+
+// Log 每一次配置下发追加一行JSON记录到本地按大小滚动的文件
+type Log struct {
+	file *util.RotateFile
+
+	mu sync.Mutex
+	// key -> 最后一次下发成功的版本
+	versions map[string]string
+	// 配置文件路径 -> key, 回滚时只知道路径
+	paths map[string]string
+}
+
+// New 未开启时返回 nil, 所有方法都可以在 nil 上调用
+func New(config Config, dir string) *Log {
+	if !config.Enable {
+		return nil
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultMaxSize
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = DefaultMaxBackups
+	}
+	l := &Log{
+		file:     util.NewRotateFile(filepath.Join(dir, fileName), int64(config.MaxSize)<<20, config.MaxBackups),
+		versions: make(map[string]string),
+		paths:    make(map[string]string),
+	}
+	l.load()
+	return l
+}
+
+// Record 记录一次配置下发, value 为配置中心的原始内容, applyErr 为下发返回的错误
+// 不在agent处理范围内的环境不记录
+func (l *Log) Record(trigger, key, value string, apply structs.ConfApply, applyErr error) {
+	if l == nil || errors.Is(applyErr, structs.ErrEnvPass) {
+		return
+	}
+	// value 解析失败时同样需要记录
+	confuValue, _ := structs.ParserConfValue(value)
+	record := structs.ConfAudit{
+		Trigger: trigger,
+		Key:     key,
+		Version: confuValue.Metadata.Version,
+		Paths:   apply.Paths,
+		Status:  structs.ConfApplyStatus(applyErr),
+	}
+	if applyErr != nil {
+		record.Error = applyErr.Error()
+	} else if apply.Deleted {
+		record.Status = structs.ConfStatusDeleted
+	}
+	l.append(record)
+}
+
+// RecordRollback 记录配置文件回滚, version 为回滚后文件内容的MD5
+func (l *Log) RecordRollback(path, version string, rollbackErr error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	key := l.paths[path]
+	l.mu.Unlock()
+	record := structs.ConfAudit{
+		Trigger: structs.ConfTriggerRollback,
+		Key:     key,
+		Version: version,
+		Paths:   []string{path},
+		Status:  structs.ConfStatusApplied,
+	}
+	if rollbackErr != nil {
+		record.Status = structs.ConfStatusWriteFailed
+		record.Error = rollbackErr.Error()
+	}
+	l.append(record)
+}
+
+// RecordHeal 记录漂移检查将配置文件恢复为最后一次下发的内容
+func (l *Log) RecordHeal(drift structs.ConfDrift) {
+	if l == nil || !drift.Healed {
+		return
+	}
+	l.append(structs.ConfAudit{
+		Trigger: structs.ConfTriggerHeal,
+		Key:     drift.Key,
+		Version: drift.Version,
+		Paths:   []string{drift.Path},
+		Status:  structs.ConfStatusHealed,
+	})
+}
+
+// Query 按条件查询审计记录, 从新到旧
+func (l *Log) Query(query Query) ([]structs.ConfAudit, error) {
+	records := make([]structs.ConfAudit, 0)
+	if l == nil {
+		return records, nil
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	// 避免查询过程中文件滚动
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, path := range l.file.Files() {
+		matched := make([]structs.ConfAudit, 0)
+		err := scan(path, func(record structs.ConfAudit) {
+			if query.match(record) {
+				matched = append(matched, record)
+			}
+		})
+		if err != nil {
+			return records, err
+		}
+		// 文件内从旧到新
+		for i := len(matched) - 1; i >= 0 && len(records) < limit; i-- {
+			records = append(records, matched[i])
+		}
+		if len(records) >= limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+// Close ...
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+func (l *Log) append(record structs.ConfAudit) {
+	record.Timestamp = time.Now().Unix()
+	if record.Paths == nil {
+		record.Paths = make([]string, 0)
+	}
+	if confuKeys, err := structs.ParserConfKey(record.Key); err == nil {
+		record.App, record.Env, record.File, record.Port = confuKeys.AppName, confuKeys.EnvName, confuKeys.FileName, confuKeys.Port
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record.PrevVersion = l.versions[record.Key]
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		xlog.Error("confProxy audit write error", xlog.String("key", record.Key), xlog.String("err", err.Error()))
+	}
+	l.remember(record)
+}
+
+// load 从已有的记录中恢复每个配置最后一次下发成功的版本
+func (l *Log) load() {
+	files := l.file.Files()
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := scan(files[i], l.remember); err != nil {
+			xlog.Error("confProxy audit load error", xlog.String("path", files[i]), xlog.String("err", err.Error()))
+		}
+	}
+}
+
+func (l *Log) remember(record structs.ConfAudit) {
+	if record.Key == "" {
+		return
+	}
+	switch record.Status {
+	case structs.ConfStatusApplied, structs.ConfStatusHealed:
+		l.versions[record.Key] = record.Version
+		for _, path := range record.Paths {
+			l.paths[path] = record.Key
+		}
+	case structs.ConfStatusDeleted:
+		delete(l.versions, record.Key)
+		for _, path := range record.Paths {
+			delete(l.paths, path)
+		}
+	}
+}
+
+func (q Query) match(record structs.ConfAudit) bool {
+	if q.App != "" && q.App != record.App {
+		return false
+	}
+	if q.Env != "" && q.Env != record.Env {
+		return false
+	}
+	if q.File != "" && q.File != record.File {
+		return false
+	}
+	if q.Start > 0 && record.Timestamp < q.Start {
+		return false
+	}
+	if q.End > 0 && record.Timestamp > q.End {
+		return false
+	}
+	return true
+}
+
+// scan 逐行读取记录, 无法解析的行(如写了一半)跳过
+func scan(path string, fn func(structs.ConfAudit)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLen)
+	for scanner.Scan() {
+		var record structs.ConfAudit
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		fn(record)
+	}
+	return scanner.Err()
+}
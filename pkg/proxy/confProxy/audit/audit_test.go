@@ -0,0 +1,114 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "/juno-agent/host-1/demo/dev/static/config.toml/8023"
+
+func testValue(version string) string {
+	return fmt.Sprintf(`{"content":"a = 1","metadata":{"version":%q,"format":"toml","paths":["/tmp/demo/config.toml"]}}`, version)
+}
+
+func TestLog_Record(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	l := New(Config{Enable: true}, dir)
+	apply := structs.ConfApply{Paths: []string{"/tmp/demo/config.toml"}}
+	l.Record(structs.ConfTriggerScanner, testKey, testValue("v1"), apply, nil)
+	l.Record(structs.ConfTriggerWatch, testKey, testValue("v2"), structs.ConfApply{}, structs.NewConfApplyError(structs.ConfStatusRenderFailed, errors.New("missing key")))
+	l.Record(structs.ConfTriggerWatch, testKey, testValue("v3"), apply, nil)
+	// 不处理的环境不记录
+	l.Record(structs.ConfTriggerWatch, testKey, testValue("v4"), apply, structs.NewConfApplyError(structs.ConfStatusEnvSkipped, structs.ErrEnvPass))
+	l.RecordRollback("/tmp/demo/config.toml", "md5-v1", nil)
+
+	records, err := l.Query(Query{App: "demo"})
+	assert.Nil(t, err)
+	assert.Len(t, records, 4)
+	// 从新到旧
+	assert.Equal(t, structs.ConfTriggerRollback, records[0].Trigger)
+	assert.Equal(t, testKey, records[0].Key)
+	assert.Equal(t, "8023", records[0].Port)
+	assert.Equal(t, "v3", records[0].PrevVersion)
+	// 下发失败不改变上一次成功的版本
+	assert.Equal(t, "v3", records[1].Version)
+	assert.Equal(t, "v1", records[1].PrevVersion)
+	assert.Equal(t, structs.ConfStatusRenderFailed, records[2].Status)
+	assert.Equal(t, "v1", records[2].PrevVersion)
+	assert.NotEmpty(t, records[2].Error)
+	assert.Equal(t, "", records[3].PrevVersion)
+	assert.Equal(t, []string{"/tmp/demo/config.toml"}, records[3].Paths)
+
+	records, err = l.Query(Query{App: "demo", File: "log.toml"})
+	assert.Nil(t, err)
+	assert.Len(t, records, 0)
+	records, err = l.Query(Query{Env: "dev", Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	records, err = l.Query(Query{Start: records[0].Timestamp + 1})
+	assert.Nil(t, err)
+	assert.Len(t, records, 0)
+	assert.Nil(t, l.Close())
+
+	// 重启后从已有记录恢复上一次的版本
+	l = New(Config{Enable: true}, dir)
+	l.Record(structs.ConfTriggerReload, testKey, testValue("v5"), apply, nil)
+	records, err = l.Query(Query{Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "md5-v1", records[0].PrevVersion)
+	assert.Nil(t, l.Close())
+}
+
+func TestLog_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	l := New(Config{Enable: true}, dir)
+	l.file = util.NewRotateFile(filepath.Join(dir, fileName), 512, 2)
+	for i := 0; i < 20; i++ {
+		l.Record(structs.ConfTriggerWatch, testKey, testValue(fmt.Sprintf("v%d", i)), structs.ConfApply{}, nil)
+	}
+	assert.Len(t, l.file.Files(), 3)
+	records, err := l.Query(Query{})
+	assert.Nil(t, err)
+	// 最旧的记录已被删除
+	assert.True(t, len(records) < 20)
+	assert.Equal(t, "v19", records[0].Version)
+	for i := 1; i < len(records); i++ {
+		assert.Equal(t, records[i].Version, records[i-1].PrevVersion)
+	}
+	assert.Nil(t, l.Close())
+
+	// 未开启时不记录
+	disabled := New(Config{}, dir)
+	disabled.Record(structs.ConfTriggerWatch, testKey, testValue("v1"), structs.ConfApply{}, nil)
+	records, err = disabled.Query(Query{})
+	assert.Nil(t, err)
+	assert.Len(t, records, 0)
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confProxy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/merge"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/labstack/echo/v4"
+)
+
+// GetBundle 返回应用的全部配置文件, key 为文件名
+// 每个文件使用优先级最高的范围(host > zone > region > cluster), port 不为空时只使用该端口的host配置
+// merge 为 true 时按 cluster -> region -> zone -> host 的顺序深度合并 toml/yaml/json 配置, 其他格式仍然按优先级覆盖
+// 配置中心不可用时返回本地缓存的数据, 同时返回 cache.ErrStale
+func (cp *ConfProxy) GetBundle(ctx echo.Context, appName, appEnv, port string, merge bool) (map[string]structs.ConfBundleFile, error) {
+	layers, err := cp.dataSource.GetLayers(ctx, appName, appEnv)
+	if err != nil && !IsStale(err) {
+		return nil, err
+	}
+	files := make(map[string][]structs.ConfLayer)
+	for _, layer := range layers {
+		if port != "" && layer.Port != "" && layer.Port != port {
+			continue
+		}
+		files[layer.FileName] = append(files[layer.FileName], layer)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("unknown config")
+	}
+
+	bundle := make(map[string]structs.ConfBundleFile, len(files))
+	for name, fileLayers := range files {
+		file, mergeErr := bundleFile(sortLayers(fileLayers), merge)
+		if mergeErr != nil {
+			return nil, fmt.Errorf("%s: %w", name, mergeErr)
+		}
+		file.Stale = IsStale(err)
+		bundle[name] = file
+	}
+	return bundle, err
+}
+
+// sortLayers 按优先级从低到高排序, 同一个范围只保留最新发布的配置
+func sortLayers(layers []structs.ConfLayer) []structs.ConfLayer {
+	sort.SliceStable(layers, func(i, j int) bool {
+		ri, rj := structs.ScopeRank(layers[i].Scope), structs.ScopeRank(layers[j].Scope)
+		if ri != rj {
+			return ri < rj
+		}
+		return layers[i].Value.Metadata.Timestamp < layers[j].Value.Metadata.Timestamp
+	})
+	res := layers[:0]
+	for i, layer := range layers {
+		if i+1 < len(layers) && layers[i+1].Scope == layer.Scope {
+			continue
+		}
+		res = append(res, layer)
+	}
+	return res
+}
+
+func bundleFile(layers []structs.ConfLayer, needMerge bool) (structs.ConfBundleFile, error) {
+	top := layers[len(layers)-1]
+	if !needMerge || len(layers) == 1 || !merge.Supported(top.Value.Metadata.Format) {
+		return structs.ConfBundleFile{ContentNode: top.Value.ContentNode(), Scopes: []string{top.Scope}}, nil
+	}
+	var (
+		contents  = make([]string, 0, len(layers))
+		scopes    = make([]string, 0, len(layers))
+		timestamp int64
+	)
+	for _, layer := range layers {
+		if layer.Value.Metadata.Format != top.Value.Metadata.Format {
+			return structs.ConfBundleFile{}, fmt.Errorf("merge %s config with %s config of scope %s", top.Value.Metadata.Format, layer.Value.Metadata.Format, layer.Scope)
+		}
+		contents = append(contents, layer.Value.Content)
+		scopes = append(scopes, layer.Scope)
+		if layer.Value.Metadata.Timestamp > timestamp {
+			timestamp = layer.Value.Metadata.Timestamp
+		}
+	}
+	content, err := merge.Merge(top.Value.Metadata.Format, contents...)
+	if err != nil {
+		return structs.ConfBundleFile{}, err
+	}
+	return structs.ConfBundleFile{
+		ContentNode: structs.ContentNode{
+			Content:   content,
+			Version:   util.MD5(content),
+			Format:    top.Value.Metadata.Format,
+			Scope:     top.Scope,
+			Timestamp: timestamp,
+		},
+		Scopes: scopes,
+	}, nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	// schemaVersion 本地缓存文件格式版本，格式不兼容时递增
+	schemaVersion = 1
+	cacheFileExt  = ".json"
+)
+
+var (
+	// ErrStale 配置中心不可用，返回的数据来自本地缓存
+	ErrStale = errors.New("stale config from local cache")
+	// ErrNotFound ...
+	ErrNotFound = errors.New("config not found in local cache")
+)
+
+// Entry 本地缓存的一条配置, Value 为配置中心下发的原始 ConfValue
+type Entry struct {
+	Schema    int    `json:"schema"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Version   string `json:"version"`   // Metadata.Version
+	Timestamp int64  `json:"timestamp"` // Metadata.Timestamp
+	CachedAt  int64  `json:"cached_at"` // 写入缓存的时间
+}
+
+// ConfValue ...
+func (e *Entry) ConfValue() (structs.ConfValue, error) {
+	return structs.ParserConfValue(e.Value)
+}
+
+// ConfNode 将缓存还原为 ConfNode
+func (e *Entry) ConfNode() (*structs.ConfNode, error) {
+	confKey, err := structs.ParserConfKey(e.Key)
+	if err != nil {
+		return nil, err
+	}
+	confValue, err := e.ConfValue()
+	if err != nil {
+		return nil, err
+	}
+	return confValue.ConfNode(confKey), nil
+}
+
+// Cache 配置中心数据的本地磁盘缓存，配置中心不可用时作为兜底数据
+type Cache struct {
+	dir     string
+	mu      sync.RWMutex
+	entries map[string]*Entry
+}
+
+// New ...
+func New(dir string) *Cache {
+	return &Cache{
+		dir:     dir,
+		entries: make(map[string]*Entry),
+	}
+}
+
+// Dir ...
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Warm 从磁盘加载缓存
+func (c *Cache) Warm() ([]*Entry, error) {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, info := range files {
+		if info.IsDir() || filepath.Ext(info.Name()) != cacheFileExt {
+			continue
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(c.dir, info.Name()))
+		if err != nil {
+			xlog.Error("confProxy cache", xlog.String("step", "read"), xlog.String("file", info.Name()), xlog.String("err", err.Error()))
+			continue
+		}
+		entry := &Entry{}
+		if err := json.Unmarshal(buf, entry); err != nil || entry.Schema != schemaVersion {
+			xlog.Warn("confProxy cache", xlog.String("step", "decode"), xlog.String("file", info.Name()))
+			continue
+		}
+		c.entries[entry.Key] = entry
+	}
+	return c.list(""), nil
+}
+
+// Put 缓存配置中心下发的配置, 旧版本不会覆盖新版本
+func (c *Cache) Put(key, value string) error {
+	confValue, err := structs.ParserConfValue(value)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[key]; ok {
+		if old.Version == confValue.Metadata.Version || old.Timestamp > confValue.Metadata.Timestamp {
+			return nil
+		}
+	}
+	entry := &Entry{
+		Schema:    schemaVersion,
+		Key:       key,
+		Value:     value,
+		Version:   confValue.Metadata.Version,
+		Timestamp: confValue.Metadata.Timestamp,
+		CachedAt:  time.Now().Unix(),
+	}
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(c.path(key), string(buf), 0644); err != nil {
+		return err
+	}
+	c.entries[key] = entry
+	return nil
+}
+
+// Get ...
+func (c *Cache) Get(key string) (*Entry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+// Delete ...
+func (c *Cache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	if err := os.Remove(c.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List 返回指定前缀下的缓存
+func (c *Cache) List(prefix string) []*Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.list(prefix)
+}
+
+func (c *Cache) list(prefix string) []*Entry {
+	entries := make([]*Entry, 0, len(c.entries))
+	for key, entry := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// Fallback 数据源不可用时, 按keys的顺序从缓存中获取配置
+// 命中时返回 ErrStale, 否则返回数据源的错误 cause
+func (c *Cache) Fallback(resKey string, cause error, keys ...string) (map[string]structs.ConfValue, error) {
+	res := make(map[string]structs.ConfValue)
+	if c == nil {
+		return res, cause
+	}
+	for _, key := range keys {
+		entry, err := c.Get(key)
+		if err != nil {
+			continue
+		}
+		confValue, err := entry.ConfValue()
+		if err != nil {
+			continue
+		}
+		res[resKey] = confValue
+		return res, ErrStale
+	}
+	return res, cause
+}
+
+// FallbackPrefix 数据源不可用时, 从缓存中获取前缀下的配置, 返回 key -> value
+// 命中时返回 ErrStale, 否则返回数据源的错误 cause
+func (c *Cache) FallbackPrefix(cause error, prefixes ...string) (map[string]string, error) {
+	res := make(map[string]string)
+	if c == nil {
+		return res, cause
+	}
+	for _, prefix := range prefixes {
+		for _, entry := range c.List(prefix) {
+			res[entry.Key] = entry.Value
+		}
+	}
+	if len(res) == 0 {
+		return res, cause
+	}
+	return res, ErrStale
+}
+
+// ConfNodes 从缓存还原前缀下的配置节点
+func (c *Cache) ConfNodes(prefix string) []*structs.ConfNode {
+	confuNodes := make([]*structs.ConfNode, 0)
+	if c == nil {
+		return confuNodes
+	}
+	for _, entry := range c.List(prefix) {
+		if confuNode, err := entry.ConfNode(); err == nil {
+			confuNodes = append(confuNodes, confuNode)
+		}
+	}
+	return confuNodes
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, util.MD5(key)+cacheFileExt)
+}
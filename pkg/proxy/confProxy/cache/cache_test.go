@@ -0,0 +1,57 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testKey = "/juno-agent/host1/app1/dev/static/config-dev.toml/9999"
+	testV1  = `{"content":"a=1","metadata":{"timestamp":100,"version":"v1","format":"toml"}}`
+	testV2  = `{"content":"a=2","metadata":{"timestamp":200,"version":"v2","format":"toml"}}`
+)
+
+func TestCache_PutAndWarm(t *testing.T) {
+	dir := t.TempDir()
+	c := New(dir)
+	assert.Nil(t, c.Put(testKey, testV2))
+	// older version must not override newer one
+	assert.Nil(t, c.Put(testKey, testV1))
+
+	warmed := New(dir)
+	entries, err := warmed.Warm()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "v2", entries[0].Version)
+
+	node, err := entries[0].ConfNode()
+	assert.Nil(t, err)
+	assert.Equal(t, "app1", node.AppName)
+	assert.Equal(t, "a=2", node.Configuration.Content)
+
+	assert.Equal(t, 1, len(warmed.List("/juno-agent/host1/")))
+	assert.Nil(t, warmed.Delete(testKey))
+	_, err = warmed.Get(testKey)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestCache_WarmEmptyDir(t *testing.T) {
+	entries, err := New(t.TempDir() + "/not-exist").Warm()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(entries))
+}
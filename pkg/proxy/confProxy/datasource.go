@@ -15,6 +15,9 @@
 package confProxy
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/labstack/echo/v4"
 )
@@ -22,9 +25,41 @@ import (
 // DataSource confu proxy dataSource interface ...
 type DataSource interface {
 	ListenAppConfig(ctx echo.Context, key string) chan *structs.ConfNode
-	GetValues(ctx echo.Context, keys ...string) (map[string]string, error)
-	GetRawValues(ctx echo.Context, rawKey string) (map[string]string, error)
+	Subscribe(key string, ch chan *structs.ConfNode)
+	RemoveListener(key string, ch chan *structs.ConfNode)
+	GetValues(ctx echo.Context, keys ...string) (map[string]structs.ConfValue, error)
+	GetRawValues(ctx echo.Context, rawKey string) (map[string]structs.ConfValue, error)
+	// GetLayers 返回应用在本机各个范围(cluster/zone/host)下发的全部配置文件
+	GetLayers(ctx echo.Context, appName, appEnv string) ([]structs.ConfLayer, error)
 	AppConfigScanner() []*structs.ConfNode
 	Reload() error
+	// Status 监听配置变化的状态
+	Status() structs.WatchStatus
 	Stop()
 }
+
+// DataSourceBuilder build the dataSource by config
+type DataSourceBuilder func(config *Config) (DataSource, error)
+
+var (
+	dataSourceMu       sync.RWMutex
+	dataSourceBuilders = make(map[string]DataSourceBuilder)
+)
+
+// RegisterDataSource register a dataSource builder, the later one overwrites the former one with the same name
+func RegisterDataSource(name string, builder DataSourceBuilder) {
+	dataSourceMu.Lock()
+	defer dataSourceMu.Unlock()
+	dataSourceBuilders[name] = builder
+}
+
+// buildDataSource ...
+func buildDataSource(name string, config *Config) (DataSource, error) {
+	dataSourceMu.RLock()
+	builder, ok := dataSourceBuilders[name]
+	dataSourceMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("confProxy dataSource %s not registered", name)
+	}
+	return builder(config)
+}
@@ -0,0 +1,308 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drift
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/writer"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// DefaultInterval 默认检查间隔
+const DefaultInterval = time.Minute
+
+// Config 配置文件漂移检查
+type Config struct {
+	Enable   bool          `json:"enable"`
+	Interval time.Duration `json:"interval"` // 检查间隔, 默认 1m
+	Heal     bool          `json:"heal"`     // 发现不一致时重新写入最后一次下发的内容
+}
+
+// file 最后一次下发到磁盘的配置
+type file struct {
+	key      string
+	version  string
+	checksum string
+	content  string
+}
+
+// Detector 定期比较配置文件在磁盘上的MD5与最后一次下发的内容, 发现被手动修改或删除的配置文件
+type Detector struct {
+	config   Config
+	writer   *writer.Writer
+	callback func(structs.ConfDrift)
+
+	mu     sync.Mutex
+	files  map[string]*file // path -> file
+	drifts map[string]structs.ConfDrift
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// New 未开启时返回 nil, 所有方法都可以在 nil 上调用
+func New(config Config, fileWriter *writer.Writer) *Detector {
+	if !config.Enable {
+		return nil
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	return &Detector{
+		config: config,
+		writer: fileWriter,
+		files:  make(map[string]*file),
+		drifts: make(map[string]structs.ConfDrift),
+		stop:   make(chan struct{}),
+	}
+}
+
+// SetCallback 发现新的不一致或者恢复后回调, 用于上报
+func (d *Detector) SetCallback(callback func(structs.ConfDrift)) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.callback = callback
+}
+
+// Track 记录配置最后一次写入的内容, 该配置不再写入的路径不再检查
+func (d *Detector) Track(key, version, content string, paths []string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.track(key, version, content, paths)
+}
+
+// Write 写入配置文件并记录写入的内容, 写入期间不会恢复, 避免恢复覆盖正在下发的配置
+func (d *Detector) Write(key, version, content string, paths []string, write func() error) error {
+	if d == nil {
+		return write()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := write(); err != nil {
+		return err
+	}
+	d.track(key, version, content, paths)
+	return nil
+}
+
+// Untrack 配置下线后不再检查
+func (d *Detector) Untrack(paths []string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.untrack(paths)
+}
+
+// Remove 删除配置文件后不再检查, 删除期间不会恢复
+func (d *Detector) Remove(paths []string, remove func() error) error {
+	if d == nil {
+		return remove()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := remove(); err != nil {
+		return err
+	}
+	d.untrack(paths)
+	return nil
+}
+
+func (d *Detector) track(key, version, content string, paths []string) {
+	for path, f := range d.files {
+		if f.key == key {
+			delete(d.files, path)
+			delete(d.drifts, path)
+		}
+	}
+	checksum := util.MD5(content)
+	for _, path := range paths {
+		d.files[path] = &file{key: key, version: version, checksum: checksum, content: content}
+		delete(d.drifts, path)
+	}
+}
+
+func (d *Detector) untrack(paths []string) {
+	for _, path := range paths {
+		delete(d.files, path)
+		delete(d.drifts, path)
+	}
+}
+
+// Accept 以磁盘上的内容作为最后一次下发的内容, 如回滚之后
+func (d *Detector) Accept(path string) error {
+	if d == nil {
+		return nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if f, ok := d.files[path]; ok {
+		f.content = string(content)
+		f.checksum = util.MD5(f.content)
+		delete(d.drifts, path)
+	}
+	return nil
+}
+
+// Start 定期检查
+func (d *Detector) Start() {
+	if d == nil {
+		return
+	}
+	xgo.Go(func() {
+		ticker := time.NewTicker(d.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.Scan()
+			case <-d.stop:
+				return
+			}
+		}
+	})
+}
+
+// Stop ...
+func (d *Detector) Stop() {
+	if d == nil {
+		return
+	}
+	d.once.Do(func() {
+		close(d.stop)
+	})
+}
+
+// Scan 检查全部配置文件, 返回不一致的配置文件
+func (d *Detector) Scan() []structs.ConfDrift {
+	if d == nil {
+		return []structs.ConfDrift{}
+	}
+	d.mu.Lock()
+	files := make(map[string]file, len(d.files))
+	for path, f := range d.files {
+		files[path] = *f
+	}
+	d.mu.Unlock()
+
+	for path, f := range files {
+		drift, ok := d.check(path, f)
+		d.mu.Lock()
+		// 检查期间配置重新下发
+		if current, tracked := d.files[path]; !tracked || current.checksum != f.checksum {
+			d.mu.Unlock()
+			continue
+		}
+		last, existed := d.drifts[path]
+		if !ok {
+			delete(d.drifts, path)
+			d.mu.Unlock()
+			continue
+		}
+		d.drifts[path] = drift
+		callback := d.callback
+		d.mu.Unlock()
+		// 同一个不一致只上报一次
+		if existed && last.Actual == drift.Actual && last.Healed == drift.Healed && last.Error == drift.Error {
+			continue
+		}
+		xlog.Warn("confProxy config drift", xlog.String("path", path), xlog.String("expected", drift.Expected),
+			xlog.String("actual", drift.Actual), xlog.Any("healed", drift.Healed))
+		if callback != nil {
+			callback(drift)
+		}
+	}
+	return d.Drifts()
+}
+
+// Drifts 返回最近一次检查发现的不一致
+func (d *Detector) Drifts() []structs.ConfDrift {
+	res := make([]structs.ConfDrift, 0)
+	if d == nil {
+		return res
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, drift := range d.drifts {
+		res = append(res, drift)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res
+}
+
+// check 返回配置文件是否与最后一次下发的内容不一致, 开启 Heal 时重新写入
+func (d *Detector) check(path string, f file) (structs.ConfDrift, bool) {
+	drift := structs.ConfDrift{
+		Key:        f.key,
+		Path:       path,
+		Version:    f.version,
+		Expected:   f.checksum,
+		DetectedAt: time.Now().Unix(),
+	}
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		drift.Missing = true
+	case err != nil:
+		drift.Error = err.Error()
+		return drift, true
+	default:
+		drift.Actual = util.MD5(string(content))
+		if drift.Actual == f.checksum {
+			return drift, false
+		}
+	}
+	if !d.config.Heal {
+		return drift, true
+	}
+	// 下发与恢复互斥, 写入前确认扫描期间配置没有重新下发,
+	// 并且磁盘上仍是检测到的内容, 否则跳过, 由下一次扫描重新检查
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if current, tracked := d.files[path]; !tracked || current.checksum != f.checksum {
+		return drift, false
+	}
+	// 写入时会将修改后的文件保存为历史版本
+	if _, err := d.writer.WriteIf(path, f.content, f.checksum, drift.Actual); err != nil {
+		if errors.Is(err, writer.ErrConflict) {
+			return drift, false
+		}
+		drift.Error = err.Error()
+		return drift, true
+	}
+	drift.Healed = true
+	return drift, true
+}
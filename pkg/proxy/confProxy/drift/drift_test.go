@@ -0,0 +1,150 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drift
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/writer"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "/juno-agent/host1/app1/dev/static/config-dev.toml/9999"
+
+func TestDetector_Scan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	content := "a = 1\n"
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+	assert.Nil(t, New(Config{}, nil))
+	detector := New(Config{Enable: true}, writer.New(1))
+	reported := make([]structs.ConfDrift, 0)
+	detector.SetCallback(func(drift structs.ConfDrift) {
+		reported = append(reported, drift)
+	})
+	detector.Track(testKey, util.MD5(content), content, []string{path})
+	assert.Empty(t, detector.Scan())
+
+	// 手动修改, 同一个不一致只上报一次
+	assert.Nil(t, ioutil.WriteFile(path, []byte("a = 2\n"), 0644))
+	drifts := detector.Scan()
+	assert.Len(t, drifts, 1)
+	assert.Equal(t, util.MD5("a = 2\n"), drifts[0].Actual)
+	assert.Equal(t, util.MD5(content), drifts[0].Expected)
+	detector.Scan()
+	assert.Len(t, reported, 1)
+
+	// 删除
+	assert.Nil(t, os.Remove(path))
+	drifts = detector.Scan()
+	assert.True(t, drifts[0].Missing)
+	assert.Len(t, reported, 2)
+
+	// 重新下发后不再不一致
+	assert.Nil(t, ioutil.WriteFile(path, []byte("a = 3\n"), 0644))
+	detector.Track(testKey, util.MD5("a = 3\n"), "a = 3\n", []string{path})
+	assert.Empty(t, detector.Scan())
+}
+
+func TestDetector_Heal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	content := "a = 1\n"
+	assert.Nil(t, ioutil.WriteFile(path, []byte("a = 2\n"), 0644))
+
+	detector := New(Config{Enable: true, Heal: true}, writer.New(1))
+	detector.Track(testKey, util.MD5(content), content, []string{path})
+	drifts := detector.Scan()
+	assert.Len(t, drifts, 1)
+	assert.True(t, drifts[0].Healed)
+	written, _ := ioutil.ReadFile(path)
+	assert.Equal(t, content, string(written))
+	assert.Empty(t, detector.Scan())
+
+	// 回滚之后以磁盘上的内容为准
+	assert.Nil(t, ioutil.WriteFile(path, []byte("a = 0\n"), 0644))
+	assert.Nil(t, detector.Accept(path))
+	assert.Empty(t, detector.Scan())
+}
+
+func TestDetector_HealConcurrentPut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+
+	w := writer.New(0)
+	detector := New(Config{Enable: true, Heal: true}, w)
+	// 和下发一样写入文件并跟踪, 恢复不能覆盖新下发的内容
+	put := func(content string) {
+		assert.Nil(t, detector.Write(testKey, util.MD5(content), content, []string{path}, func() error {
+			_, err := w.WriteAll([]string{path}, content, util.MD5(content))
+			return err
+		}))
+	}
+	put("a = 0\n")
+
+	// 写入之后、跟踪之前扫描
+	assert.Nil(t, detector.Write(testKey, util.MD5("a = 1\n"), "a = 1\n", []string{path}, func() error {
+		_, err := w.Write(path, "a = 1\n", "")
+		go detector.Scan()
+		time.Sleep(50 * time.Millisecond)
+		return err
+	}))
+	detector.Scan()
+	written, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "a = 1\n", string(written))
+
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				detector.Scan()
+			}
+		}
+	}()
+	last := ""
+	for i := 2; i <= 200; i++ {
+		last = fmt.Sprintf("a = %d\n", i)
+		put(last)
+	}
+	close(done)
+	wg.Wait()
+
+	written, _ = ioutil.ReadFile(path)
+	assert.Equal(t, last, string(written))
+	assert.Empty(t, detector.Scan())
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/jupiter/pkg/client/etcdv3"
+	"github.com/douyu/jupiter/pkg/util/xnet"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Reporter 将配置下发状态写入etcd的callback key, etcd和mysql数据源共用
+type Reporter struct {
+	prefix  string
+	timeout time.Duration
+	mu      sync.Mutex
+	client  *etcdv3.Client
+}
+
+// NewReporter etcd客户端在第一次上报时创建
+func NewReporter(prefix string, timeout time.Duration) *Reporter {
+	return &Reporter{prefix: prefix, timeout: timeout}
+}
+
+// Report 写入上报的key
+func (r *Reporter) Report(confuKeys structs.ConfKey, reportValue structs.ConfReport) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	ip, err := xnet.GetLocalIP()
+	if err != nil {
+		xlog.Error("checkEffectMD5", xlog.String("xnetGetLocalIPError", err.Error()))
+	}
+	reportValue.IP = ip
+
+	reportKey := strings.Join([]string{r.prefix + "/callback", confuKeys.AppName, confuKeys.FileName, confuKeys.Hostname}, "/")
+	client, err := r.getClient(etcdv3.StdConfig("default"))
+	if err != nil {
+		return err
+	}
+	if _, err := client.Put(ctx, reportKey, reportValue.JSONString()); err != nil {
+		//if err == auth.ErrInvalidAuthToken {
+		client, err = r.resetClient(client, etcdv3.RawConfig("plugin.confProxy.etcd"))
+		if err != nil {
+			return err
+		}
+		if _, err := client.Put(ctx, reportKey, reportValue.JSONString()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close ...
+func (r *Reporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.client == nil {
+		return nil
+	}
+	err := r.client.Close()
+	r.client = nil
+	return err
+}
+
+func (r *Reporter) getClient(config *etcdv3.Config) (*etcdv3.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.client != nil {
+		return r.client, nil
+	}
+	client, err := buildClient(config)
+	if err != nil {
+		return nil, err
+	}
+	r.client = client
+	return client, nil
+}
+
+// buildClient etcd不可用时 Build 会panic, 转换为错误返回
+func buildClient(config *etcdv3.Config) (client *etcdv3.Client, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("build etcd client: %v", r)
+		}
+	}()
+	return config.Build()
+}
+
+// resetClient 上报失败时使用新的客户端重试
+func (r *Reporter) resetClient(old *etcdv3.Client, config *etcdv3.Config) (*etcdv3.Client, error) {
+	r.mu.Lock()
+	if r.client == old {
+		r.client = nil
+		_ = old.Close()
+	}
+	r.mu.Unlock()
+	return r.getClient(config)
+}
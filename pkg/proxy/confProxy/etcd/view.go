@@ -16,7 +16,7 @@ package etcd
 
 // ConfDataSourceEtcd ETCD dataSource config
 type ConfDataSourceEtcd struct {
-	Enable    bool // 是否开启用该数据源
+	Enable    bool // 是否开启用该数据源, 使用mysql数据源时为是否通过etcd上报下发状态
 	Secure    bool
 	EndPoints []string `json:"endpoints"` // 注册中心etcd节点信息
 }
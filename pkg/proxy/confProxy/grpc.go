@@ -0,0 +1,111 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confProxy
+
+import (
+	"context"
+	"errors"
+
+	"github.com/douyu/juno-agent/pkg/proto/configpb"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/validator"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ConfigServer gRPC ConfigService, 与HTTP接口使用相同的 ConfProxy
+type ConfigServer struct {
+	configpb.UnimplementedConfigServiceServer
+	proxy *ConfProxy
+}
+
+// NewConfigServer ...
+func NewConfigServer(cp *ConfProxy) *ConfigServer {
+	return &ConfigServer{proxy: cp}
+}
+
+// GetConfig ...
+func (s *ConfigServer) GetConfig(ctx context.Context, req *configpb.GetConfigRequest) (*configpb.Config, error) {
+	if req.GetName() == "" || req.GetEnv() == "" || req.GetTarget() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name, env and target are required")
+	}
+	value, err := s.proxy.GetConfValue(nil, req.GetName(), req.GetEnv(), req.GetTarget(), req.GetPort())
+	return configReply(value, err)
+}
+
+// GetRawConfig ...
+func (s *ConfigServer) GetRawConfig(ctx context.Context, req *configpb.GetRawConfigRequest) (*configpb.Config, error) {
+	if req.GetRawKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "raw_key is required")
+	}
+	value, err := s.proxy.GetRawConfValue(nil, req.GetRawKey())
+	return configReply(value, err)
+}
+
+// WatchConfig 推送订阅配置的当前内容以及之后的每一次变化, 直到客户端断开
+func (s *ConfigServer) WatchConfig(req *configpb.WatchConfigRequest, stream configpb.ConfigService_WatchConfigServer) error {
+	keys := make([]string, 0, len(req.GetKeys()))
+	for _, key := range req.GetKeys() {
+		keys = append(keys, util.GetConfigKey(key.GetName(), key.GetEnv(), key.GetTarget(), key.GetPort()))
+	}
+	if len(keys)+len(req.GetRawKeys()) == 0 {
+		return status.Error(codes.InvalidArgument, "keys and raw_keys are empty")
+	}
+
+	events, cancel := s.proxy.WatchConfig(nil, keys, req.GetRawKeys())
+	defer cancel()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(&configpb.ConfigEvent{Key: event.Key, Config: configMessage(event.ContentNode)}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// configReply 配置中心不可用时返回本地缓存的数据, stale 为 true
+func configReply(value structs.ConfValue, err error) (*configpb.Config, error) {
+	if err != nil && !IsStale(err) {
+		var parseErr *validator.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, status.Error(codes.InvalidArgument, parseErr.Error())
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	node := value.ContentNode()
+	node.Stale = IsStale(err)
+	return configMessage(node), nil
+}
+
+func configMessage(node structs.ContentNode) *configpb.Config {
+	return &configpb.Config{
+		Content:   node.Content,
+		Version:   node.Version,
+		Format:    node.Format,
+		Timestamp: node.Timestamp,
+		Stale:     node.Stale,
+		Deleted:   node.Deleted,
+	}
+}
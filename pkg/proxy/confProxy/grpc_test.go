@@ -0,0 +1,69 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confProxy
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/proto/configpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestConfigServer(t *testing.T) {
+	ds := newFakeDataSource()
+	ds.publish(testRawKey, "a=1", "v1")
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	configpb.RegisterConfigServiceServer(server, NewConfigServer(NewConfProxy(true, ds)))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := configpb.NewConfigServiceClient(conn)
+
+	config, err := client.GetRawConfig(context.Background(), &configpb.GetRawConfigRequest{RawKey: testRawKey})
+	assert.Nil(t, err)
+	assert.Equal(t, "a=1", config.Content)
+	assert.Equal(t, "v1", config.Version)
+
+	_, err = client.GetRawConfig(context.Background(), &configpb.GetRawConfigRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.WatchConfig(ctx, &configpb.WatchConfigRequest{RawKeys: []string{testRawKey}})
+	assert.Nil(t, err)
+	event, err := stream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", event.Config.Version)
+
+	ds.publish(testRawKey, "a=2", "v2")
+	event, err = stream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, testRawKey, event.Key)
+	assert.Equal(t, "a=2", event.Config.Content)
+}
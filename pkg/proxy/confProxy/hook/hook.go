@@ -0,0 +1,411 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 配置写入后支持的动作
+const (
+	ActionSignal  = "signal"  // 向程序主进程发送信号, 默认 SIGHUP
+	ActionReload  = "reload"  // systemd 执行 ExecReload, supervisor 发送 SIGHUP
+	ActionRestart = "restart" // 重启程序
+	ActionHTTP    = "http"    // 调用HTTP接口
+	ActionNone    = "none"    // 不执行动作, 用于排除默认规则匹配的配置文件
+
+	// DefaultTimeout 单个动作的默认超时时间
+	DefaultTimeout = time.Second * 10
+
+	managerSystemd    = "systemd"
+	managerSupervisor = "supervisor"
+	maxOutput         = 1024
+)
+
+// Rule 配置文件写入后执行的动作
+// Path 支持 filepath.Match 的通配符, 为空时匹配所有配置文件
+// 没有匹配的规则时使用 defaultRule: 对使用该配置的程序执行 reload
+type Rule struct {
+	Path    string        `json:"path"`
+	Action  string        `json:"action"`  // signal/reload/restart/http/none
+	Signal  string        `json:"signal"`  // action 为 signal 时使用, 如 HUP、USR1 或者信号值, 默认 HUP
+	URL     string        `json:"url"`     // action 为 http 时调用的地址
+	Method  string        `json:"method"`  // 默认 POST
+	Timeout time.Duration `json:"timeout"` // 默认 10s
+}
+
+// Resolver 返回使用该配置文件的程序
+type Resolver func(path string) []*structs.ProgramExt
+
+// defaultRule 没有匹配的规则时, 对支持 reload 的程序执行 reload
+var defaultRule = Rule{Action: ActionReload}
+
+// Hooks 配置写入后, 对使用该配置的 supervisor/systemd 程序执行动作
+// 动作在每个程序各自的队列中按顺序异步执行, 不阻塞配置下发
+type Hooks struct {
+	rules    []Rule
+	resolver Resolver
+	mu       sync.RWMutex
+
+	queueMu sync.Mutex
+	queues  map[string][]task // 程序 -> 等待执行的动作, 存在时该程序的队列正在执行
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// task 对一个程序执行的动作, 执行后以结果调用 done
+type task struct {
+	rule    Rule
+	path    string
+	program *structs.ProgramExt
+	done    func(structs.ConfHookResult)
+}
+
+// New ...
+func New(rules []Rule) *Hooks {
+	return &Hooks{rules: rules, queues: make(map[string][]task)}
+}
+
+// SetResolver 设置配置文件与程序的对应关系
+func (h *Hooks) SetResolver(resolver Resolver) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resolver = resolver
+}
+
+// Run 对已写入的配置文件异步执行匹配的动作, 只有被已知程序使用的配置文件才会执行
+// 全部动作执行后以结果调用 done, 返回是否有需要执行的动作, 没有时不调用 done
+func (h *Hooks) Run(paths []string, done func([]structs.ConfHookResult)) bool {
+	if h == nil {
+		return false
+	}
+	tasks := h.tasks(paths)
+	if len(tasks) == 0 {
+		return false
+	}
+	var (
+		mu      sync.Mutex
+		results = make([]structs.ConfHookResult, len(tasks))
+		left    = len(tasks)
+	)
+	for i := range tasks {
+		i := i
+		tasks[i].done = func(result structs.ConfHookResult) {
+			mu.Lock()
+			results[i] = result
+			left--
+			finished := left == 0
+			mu.Unlock()
+			if finished && done != nil {
+				done(results)
+			}
+		}
+	}
+	return h.enqueue(tasks)
+}
+
+// Stop 不再接收新的动作, 等待执行的动作以失败结果返回, 等待正在执行的动作完成
+func (h *Hooks) Stop() {
+	if h == nil {
+		return
+	}
+	h.queueMu.Lock()
+	h.closed = true
+	h.queueMu.Unlock()
+	h.wg.Wait()
+}
+
+// tasks 返回配置文件需要执行的动作
+func (h *Hooks) tasks(paths []string) []task {
+	h.mu.RLock()
+	resolver := h.resolver
+	h.mu.RUnlock()
+	tasks := make([]task, 0)
+	if resolver == nil {
+		return tasks
+	}
+	for _, path := range paths {
+		rule, matched := h.match(path)
+		if rule.Action == ActionNone {
+			continue
+		}
+		programs := resolver(path)
+		if len(programs) == 0 {
+			continue
+		}
+		if rule.Action == ActionHTTP {
+			// 同一个配置文件只调用一次
+			tasks = append(tasks, task{rule: rule, path: path, program: programs[0]})
+			continue
+		}
+		for _, program := range programs {
+			if !matched && program.Manager == managerSystemd && program.ExecReload == "" {
+				// 默认规则不处理不支持 reload 的 unit
+				continue
+			}
+			tasks = append(tasks, task{rule: rule, path: path, program: program})
+		}
+	}
+	return tasks
+}
+
+// enqueue 将动作加入程序的队列, 队列没有在执行时启动执行
+func (h *Hooks) enqueue(tasks []task) bool {
+	h.queueMu.Lock()
+	defer h.queueMu.Unlock()
+	if h.closed {
+		return false
+	}
+	for _, t := range tasks {
+		key := t.key()
+		if _, running := h.queues[key]; !running {
+			h.wg.Add(1)
+			go h.work(key)
+		}
+		h.queues[key] = append(h.queues[key], t)
+	}
+	return true
+}
+
+// work 按顺序执行程序队列中的动作, 队列为空时退出
+func (h *Hooks) work(key string) {
+	defer h.wg.Done()
+	for {
+		h.queueMu.Lock()
+		tasks := h.queues[key]
+		if len(tasks) == 0 || h.closed {
+			delete(h.queues, key)
+			h.queueMu.Unlock()
+			// 停止时丢弃的动作也需要返回结果, 否则不会上报
+			for _, t := range tasks {
+				t.done(t.stopped())
+			}
+			return
+		}
+		t := tasks[0]
+		h.queues[key] = tasks[1:]
+		h.queueMu.Unlock()
+		t.done(t.rule.run(t.path, t.program))
+	}
+}
+
+// stopped 停止时没有执行的动作的结果
+func (t task) stopped() structs.ConfHookResult {
+	return structs.ConfHookResult{
+		Path:    t.path,
+		Manager: t.program.Manager,
+		Program: programName(t.program),
+		Action:  t.rule.Action,
+		Error:   "hooks stopped",
+	}
+}
+
+// key 同一个程序(http动作为同一个地址)的动作在一个队列中执行
+func (t task) key() string {
+	if t.rule.Action == ActionHTTP {
+		return ActionHTTP + ":" + t.rule.URL
+	}
+	return t.program.Manager + ":" + programName(t.program)
+}
+
+// match 返回第一个匹配的规则, 没有匹配时返回 defaultRule, matched 为 false
+func (h *Hooks) match(path string) (rule Rule, matched bool) {
+	for _, rule := range h.rules {
+		if rule.Path == "" {
+			return rule, true
+		}
+		if ok, _ := filepath.Match(rule.Path, path); ok {
+			return rule, true
+		}
+	}
+	return defaultRule, false
+}
+
+func (r Rule) run(path string, program *structs.ProgramExt) structs.ConfHookResult {
+	result := structs.ConfHookResult{
+		Path:    path,
+		Manager: program.Manager,
+		Program: programName(program),
+		Action:  r.Action,
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var (
+		output string
+		err    error
+	)
+	switch r.Action {
+	case ActionSignal:
+		output, err = r.signal(ctx, program)
+	case ActionReload:
+		output, err = reload(ctx, program)
+	case ActionRestart:
+		output, err = restart(ctx, program)
+	case ActionHTTP:
+		output, err = r.http(ctx)
+	default:
+		err = fmt.Errorf("unknown hook action: %s", r.Action)
+	}
+	result.Output = truncate(output)
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+		xlog.Error("confProxy hook error", xlog.String("path", path), xlog.String("program", result.Program),
+			xlog.String("action", r.Action), xlog.String("err", err.Error()))
+	} else {
+		xlog.Info("confProxy hook success", xlog.String("path", path), xlog.String("program", result.Program),
+			xlog.String("action", r.Action))
+	}
+	return result
+}
+
+// signal 向程序主进程发送信号
+func (r Rule) signal(ctx context.Context, program *structs.ProgramExt) (string, error) {
+	sig, err := util.ParseSignal(r.Signal, syscall.SIGHUP)
+	if err != nil {
+		return "", err
+	}
+	pid, err := mainPID(ctx, program)
+	if err != nil {
+		return "", err
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return "", err
+	}
+	if err := process.Signal(sig); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("send %s to pid %d", util.SignalName(sig), pid), nil
+}
+
+func (r Rule) http(ctx context.Context) (string, error) {
+	if r.URL == "" {
+		return "", errors.New("hook url is empty")
+	}
+	method := strings.ToUpper(r.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxOutput))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return string(body), fmt.Errorf("hook url response status %d", resp.StatusCode)
+	}
+	return string(body), nil
+}
+
+func reload(ctx context.Context, program *structs.ProgramExt) (string, error) {
+	switch program.Manager {
+	case managerSystemd:
+		if program.ExecReload == "" {
+			return "", fmt.Errorf("unit %s has no ExecReload", program.FileName)
+		}
+		return command(ctx, "systemctl", "reload", program.FileName)
+	case managerSupervisor:
+		return command(ctx, "supervisorctl", "signal", "HUP", program.ProgramName)
+	}
+	return "", fmt.Errorf("unknown program manager: %s", program.Manager)
+}
+
+func restart(ctx context.Context, program *structs.ProgramExt) (string, error) {
+	switch program.Manager {
+	case managerSystemd:
+		return command(ctx, "systemctl", "restart", program.FileName)
+	case managerSupervisor:
+		return command(ctx, "supervisorctl", "restart", program.ProgramName)
+	}
+	return "", fmt.Errorf("unknown program manager: %s", program.Manager)
+}
+
+// mainPID 从进程管理工具获取程序主进程的pid
+func mainPID(ctx context.Context, program *structs.ProgramExt) (int, error) {
+	var (
+		output string
+		err    error
+	)
+	switch program.Manager {
+	case managerSystemd:
+		output, err = command(ctx, "systemctl", "show", "-p", "MainPID", "--value", program.FileName)
+	case managerSupervisor:
+		output, err = command(ctx, "supervisorctl", "pid", program.ProgramName)
+	default:
+		return 0, fmt.Errorf("unknown program manager: %s", program.Manager)
+	}
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("program %s is not running: %s", programName(program), strings.TrimSpace(output))
+	}
+	return pid, nil
+}
+
+func command(ctx context.Context, name string, args ...string) (string, error) {
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return string(output), nil
+}
+
+func programName(program *structs.ProgramExt) string {
+	if program.Manager == managerSystemd {
+		return program.FileName
+	}
+	return program.ProgramName
+}
+
+func truncate(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxOutput {
+		return output[:maxOutput]
+	}
+	return output
+}
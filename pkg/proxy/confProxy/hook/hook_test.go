@@ -0,0 +1,155 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+// run 执行动作并等待结果
+func run(t *testing.T, hooks *Hooks, paths ...string) []structs.ConfHookResult {
+	ch := make(chan []structs.ConfHookResult, 1)
+	if !hooks.Run(paths, func(results []structs.ConfHookResult) { ch <- results }) {
+		return nil
+	}
+	select {
+	case results := <-ch:
+		return results
+	case <-time.After(time.Second * 5):
+		t.Fatal("wait hook results timeout")
+		return nil
+	}
+}
+
+func TestHooksRun(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	hooks := New([]Rule{
+		{Path: "/home/www/server/*/config/*.toml", Action: ActionHTTP, URL: server.URL},
+		{Path: "/home/www/other.toml", Action: ActionNone},
+	})
+	defer hooks.Stop()
+	program := &structs.ProgramExt{Manager: "supervisor", ProgramName: "demo", Config: "/home/www/server/demo/config/config.toml"}
+	hooks.SetResolver(func(path string) []*structs.ProgramExt {
+		if path == program.Config || path == "/home/www/other.toml" {
+			return []*structs.ProgramExt{program, program}
+		}
+		return nil
+	})
+
+	results := run(t, hooks, program.Config, "/tmp/unknown.toml")
+	assert.Len(t, results, 1)
+	assert.True(t, results[0].Success)
+	assert.Equal(t, "demo", results[0].Program)
+	assert.Equal(t, 1, calls)
+
+	// 规则排除的配置文件不执行动作
+	assert.Nil(t, run(t, hooks, "/home/www/other.toml"))
+}
+
+func TestHooksDefaultRule(t *testing.T) {
+	hooks := New(nil)
+	unit := &structs.ProgramExt{Manager: "systemd", FileName: "demo.service"}
+	hooks.SetResolver(func(path string) []*structs.ProgramExt {
+		return []*structs.ProgramExt{unit}
+	})
+	// 默认规则不处理不支持 reload 的 unit
+	assert.Nil(t, run(t, hooks, "/home/www/demo.toml"))
+
+	rule, matched := hooks.match("/home/www/demo.toml")
+	assert.False(t, matched)
+	assert.Equal(t, ActionReload, rule.Action)
+
+	// 停止后不再执行
+	hooks.Stop()
+	unit.ExecReload = "/bin/kill -HUP $MAINPID"
+	assert.False(t, hooks.Run([]string{"/home/www/demo.toml"}, nil))
+}
+
+func TestHooksQueue(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	hooks := New([]Rule{
+		{Path: "/slow*", Action: ActionHTTP, URL: server.URL + "/slow"},
+		{Path: "/fast*", Action: ActionHTTP, URL: server.URL + "/fast"},
+	})
+	hooks.SetResolver(func(path string) []*structs.ProgramExt {
+		return []*structs.ProgramExt{{Manager: "supervisor", ProgramName: "demo"}}
+	})
+	// Run 不等待动作执行
+	done := make(chan []structs.ConfHookResult, 2)
+	assert.True(t, hooks.Run([]string{"/slow1"}, func(results []structs.ConfHookResult) { done <- results }))
+	assert.True(t, hooks.Run([]string{"/slow2"}, func(results []structs.ConfHookResult) { done <- results }))
+	// 不同队列的动作不会被阻塞
+	assert.Len(t, run(t, hooks, "/fast"), 1)
+	close(release)
+	<-done
+	<-done
+	hooks.Stop()
+	assert.Equal(t, []string{"/fast", "/slow", "/slow"}, order)
+}
+
+func TestHooksStop(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+
+	hooks := New([]Rule{{Action: ActionHTTP, URL: server.URL}})
+	hooks.SetResolver(func(path string) []*structs.ProgramExt {
+		return []*structs.ProgramExt{{Manager: "supervisor", ProgramName: "demo"}}
+	})
+	done := make(chan []structs.ConfHookResult, 2)
+	assert.True(t, hooks.Run([]string{"/a.toml"}, func(results []structs.ConfHookResult) { done <- results }))
+	assert.True(t, hooks.Run([]string{"/b.toml"}, func(results []structs.ConfHookResult) { done <- results }))
+	<-started
+	time.AfterFunc(time.Millisecond*100, func() { close(release) })
+	hooks.Stop()
+
+	// 正在执行的动作完成, 等待执行的动作以失败结果返回
+	results := <-done
+	assert.True(t, results[0].Success)
+	results = <-done
+	assert.False(t, results[0].Success)
+	assert.Equal(t, "/b.toml", results[0].Path)
+	assert.Equal(t, "hooks stopped", results[0].Error)
+}
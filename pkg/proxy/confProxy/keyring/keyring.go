@@ -0,0 +1,94 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+)
+
+// envPrefix 密钥以 env: 开头时从环境变量中读取, 避免明文写在配置文件中
+const envPrefix = "env:"
+
+var (
+	// ErrNoKey 配置内容已加密, 但是agent没有配置对应的密钥
+	ErrNoKey = errors.New("config decrypt key not found")
+)
+
+// Config 解密配置内容的密钥
+// Keys 为 keyID -> 32位AES密钥, 配置中心通过 Metadata.KeyID 指定加密使用的密钥, 为空时使用 Default
+// 轮换密钥时先在agent中加入新密钥, 配置中心切换到新的 keyID 后再删除旧密钥
+type Config struct {
+	Default string            `json:"default"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// Ring 密钥环
+type Ring struct {
+	defaultID string
+	keys      map[string]string
+}
+
+// New ...
+func New(config Config) *Ring {
+	ring := &Ring{
+		defaultID: config.Default,
+		keys:      make(map[string]string, len(config.Keys)),
+	}
+	for id, key := range config.Keys {
+		if strings.HasPrefix(key, envPrefix) {
+			key = os.Getenv(strings.TrimPrefix(key, envPrefix))
+		}
+		// 配置加载时key不区分大小写
+		ring.keys[strings.ToLower(id)] = key
+	}
+	return ring
+}
+
+// Decrypt 解密 Metadata.Encoded 为 true 的配置内容, 解密后 Encoded 置为 false
+// 返回的错误中不包含配置内容
+func (r *Ring) Decrypt(value *structs.ConfValue) error {
+	if !value.Metadata.Encoded {
+		return nil
+	}
+	keyID := value.Metadata.KeyID
+	if keyID == "" && r != nil {
+		keyID = r.defaultID
+	}
+	key, ok := r.key(keyID)
+	if !ok {
+		return fmt.Errorf("%w: key id %q", ErrNoKey, keyID)
+	}
+	content, err := util.AESCBCDecrypt(strings.TrimSpace(value.Content), key)
+	if err != nil {
+		return fmt.Errorf("decrypt config with key id %q: %w", keyID, err)
+	}
+	value.Content = content
+	value.Metadata.Encoded = false
+	return nil
+}
+
+func (r *Ring) key(id string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	key, ok := r.keys[strings.ToLower(id)]
+	return key, ok && key != ""
+}
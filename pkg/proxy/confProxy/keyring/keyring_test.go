@@ -0,0 +1,68 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	oldKey = "12341234123412341234123412341234"
+	newKey = "abcdabcdabcdabcdabcdabcdabcdabcd"
+)
+
+func encrypted(t *testing.T, content, key, keyID string) *structs.ConfValue {
+	cipherText, err := util.AESCBCEncrypt(content, key)
+	assert.Nil(t, err)
+	return &structs.ConfValue{Content: cipherText, Metadata: structs.MetaData{Encoded: true, KeyID: keyID}}
+}
+
+func TestRing_Decrypt(t *testing.T) {
+	os.Setenv("JUNO_TEST_CONFIG_KEY", newKey)
+	defer os.Unsetenv("JUNO_TEST_CONFIG_KEY")
+	ring := New(Config{Default: "v1", Keys: map[string]string{"v1": oldKey, "v2": "env:JUNO_TEST_CONFIG_KEY"}})
+
+	// 未加密的内容不处理
+	plain := &structs.ConfValue{Content: "a=1"}
+	assert.Nil(t, ring.Decrypt(plain))
+	assert.Equal(t, "a=1", plain.Content)
+
+	// 默认密钥
+	value := encrypted(t, "a=1", oldKey, "")
+	assert.Nil(t, ring.Decrypt(value))
+	assert.Equal(t, "a=1", value.Content)
+	assert.False(t, value.Metadata.Encoded)
+
+	// 轮换后的密钥
+	value = encrypted(t, "a=2", newKey, "v2")
+	assert.Nil(t, ring.Decrypt(value))
+	assert.Equal(t, "a=2", value.Content)
+
+	// 密钥不存在
+	value = encrypted(t, "a=3", newKey, "v3")
+	assert.True(t, errors.Is(ring.Decrypt(value), ErrNoKey))
+
+	// 密钥错误
+	value = encrypted(t, "a=4", newKey, "v1")
+	err := ring.Decrypt(value)
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "a=4")
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/validator"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported 是否支持合并该格式的配置
+func Supported(format string) bool {
+	switch validator.NormalizeFormat(format) {
+	case validator.FormatToml, validator.FormatYaml, validator.FormatJSON:
+		return true
+	}
+	return false
+}
+
+// Merge 按顺序深度合并配置, 后面的配置覆盖前面的配置
+// 对象按key递归合并, 数组以及其他类型的值整体覆盖; 合并后的内容不保留注释和key的顺序
+func Merge(format string, contents ...string) (string, error) {
+	format = validator.NormalizeFormat(format)
+	if !Supported(format) {
+		return "", fmt.Errorf("merge %s config is not supported", format)
+	}
+	merged := make(map[string]interface{})
+	for _, content := range contents {
+		doc, err := decode(format, content)
+		if err != nil {
+			return "", err
+		}
+		merged = mergeMap(merged, doc)
+	}
+	return encode(format, merged)
+}
+
+func mergeMap(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		srcMap, ok := value.(map[string]interface{})
+		if !ok {
+			dst[key] = value
+			continue
+		}
+		dstMap, ok := dst[key].(map[string]interface{})
+		if !ok {
+			dstMap = make(map[string]interface{})
+		}
+		dst[key] = mergeMap(dstMap, srcMap)
+	}
+	return dst
+}
+
+func decode(format, content string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	if err := validator.Validate(format, content); err != nil {
+		return nil, err
+	}
+	var err error
+	switch format {
+	case validator.FormatToml:
+		_, err = toml.Decode(content, &doc)
+	case validator.FormatYaml:
+		err = yaml.Unmarshal([]byte(content), &doc)
+	case validator.FormatJSON:
+		err = json.Unmarshal([]byte(content), &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("merge %s config: %w", format, err)
+	}
+	return doc, nil
+}
+
+func encode(format string, doc map[string]interface{}) (string, error) {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	switch format {
+	case validator.FormatToml:
+		err = toml.NewEncoder(&buf).Encode(doc)
+	case validator.FormatYaml:
+		err = yaml.NewEncoder(&buf).Encode(doc)
+	case validator.FormatJSON:
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(doc)
+	}
+	if err != nil {
+		return "", fmt.Errorf("merge %s config: %w", format, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	cluster := "[server]\naddr = \":8080\"\ntimeout = \"1s\"\n[mysql]\ndsn = \"cluster\"\nhosts = [\"a\", \"b\"]\n"
+	zone := "[mysql]\ndsn = \"zone\"\n"
+	host := "[server]\naddr = \":9090\"\n[mysql]\nhosts = [\"c\"]\n"
+	merged, err := Merge("toml", cluster, zone, host)
+	assert.Nil(t, err)
+	assert.Equal(t, "[mysql]\n  dsn = \"zone\"\n  hosts = [\"c\"]\n\n[server]\n  addr = \":9090\"\n  timeout = \"1s\"\n", merged)
+
+	merged, err = Merge("yml", "server:\n  addr: :8080\n  debug: true\n", "server:\n  addr: :9090\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "server:\n    addr: :9090\n    debug: true\n", merged)
+
+	merged, err = Merge("json", `{"a":{"b":1,"c":[1,2]}}`, `{"a":{"c":[3]},"d":"x"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\n  \"a\": {\n    \"b\": 1,\n    \"c\": [\n      3\n    ]\n  },\n  \"d\": \"x\"\n}\n", merged)
+
+	_, err = Merge("ini", "a=1")
+	assert.NotNil(t, err)
+	_, err = Merge("json", `{"a":1}`, `{"a":`)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,339 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/applier"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/jinzhu/gorm"
+
+	// mysql driver
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+// DataSource mysql conf datasource, 配置的下发和监听的通知由 applier 处理
+type DataSource struct {
+	*applier.Applier
+	db           *gorm.DB
+	table        string
+	pollInterval time.Duration
+	// 定期对比全部key, 处理删除的配置并重试下发失败的配置
+	resyncInterval time.Duration
+	// 已处理的最大version
+	version int64
+	// 下发失败的配置 key -> version, 在下一次对比时重试
+	failed map[string]int64
+	// 轮询状态
+	status structs.WatchStatus
+	mu     sync.Mutex
+	// 串行执行全量加载、轮询和对比, 避免 Reload 与轮询同时下发
+	syncMu sync.Mutex
+
+	pollOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewMySQLDataSource ...
+func NewMySQLDataSource(config applier.Config, mysqlConfig ConfDataSourceMysql) (*DataSource, error) {
+	if mysqlConfig.Dsn == "" {
+		return nil, errors.New("mysql dsn is empty")
+	}
+	db, err := gorm.Open("mysql", mysqlConfig.Dsn)
+	if err != nil {
+		return nil, err
+	}
+	return newDataSource(config, mysqlConfig, db), nil
+}
+
+func newDataSource(config applier.Config, mysqlConfig ConfDataSourceMysql, db *gorm.DB) *DataSource {
+	if mysqlConfig.Table == "" {
+		mysqlConfig.Table = DefaultTable
+	}
+	if mysqlConfig.PollInterval <= 0 {
+		mysqlConfig.PollInterval = DefaultPollInterval
+	}
+	if mysqlConfig.ResyncInterval <= 0 {
+		mysqlConfig.ResyncInterval = DefaultResyncInterval
+	}
+	dataSource := &DataSource{
+		db:             db,
+		table:          mysqlConfig.Table,
+		pollInterval:   mysqlConfig.PollInterval,
+		resyncInterval: mysqlConfig.ResyncInterval,
+		failed:         make(map[string]int64),
+		stop:           make(chan struct{}),
+	}
+	dataSource.Applier = applier.New(config, dataSource)
+	dataSource.status.Prefix = dataSource.HostKey()
+	return dataSource
+}
+
+// Get 按key精确查询
+func (d *DataSource) Get(keys ...string) (map[string]string, error) {
+	items, err := d.getItems(keys...)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(items))
+	for key, item := range items {
+		res[key] = item.Value
+	}
+	return res, nil
+}
+
+// List 查询前缀下的全部配置
+func (d *DataSource) List(prefix string) (map[string]string, error) {
+	items, err := d.listItems(prefix, 0)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(items))
+	for _, item := range items {
+		res[item.Key] = item.Value
+	}
+	return res, nil
+}
+
+// AppConfigScanner 初始化加载实例配置, 并启动version轮询
+func (d *DataSource) AppConfigScanner() []*structs.ConfNode {
+	confuNodes, err := d.scan(structs.ConfTriggerScanner)
+	if err != nil {
+		confuNodes = d.Cached()
+	}
+	d.pollOnce.Do(func() {
+		d.mu.Lock()
+		d.status.StartedAt = time.Now().Unix()
+		d.mu.Unlock()
+		xgo.Go(d.poll)
+	})
+	return confuNodes
+}
+
+// scan 加载全部配置, trigger 为审计记录的触发来源
+func (d *DataSource) scan(trigger string) ([]*structs.ConfNode, error) {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+	hostKey := d.HostKey()
+	items, err := d.listItems(hostKey, 0)
+	d.polled(err)
+	if err != nil {
+		xlog.Error("init get hostKey error", xlog.String("plugin", "confProxy"), xlog.String("msg", err.Error()), xlog.String("hostKey", hostKey))
+		return nil, err
+	}
+	confuNodes := make([]*structs.ConfNode, 0, len(items))
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+		if confuNode, err := d.apply(trigger, item); err == nil {
+			confuNodes = append(confuNodes, confuNode)
+		}
+	}
+	d.Prune(trigger, keys)
+	return confuNodes, nil
+}
+
+// apply 下发一条配置, 失败的配置记录后在对比时重试
+func (d *DataSource) apply(trigger string, item ConfItem) (*structs.ConfNode, error) {
+	confuNode, err := d.Put(trigger, item.Key, item.Value)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil && !errors.Is(err, structs.ErrEnvPass) {
+		d.failed[item.Key] = item.Version
+	} else {
+		delete(d.failed, item.Key)
+	}
+	if item.Version > d.version {
+		d.version = item.Version
+		d.status.LastEventAt = time.Now().Unix()
+	}
+	return confuNode, err
+}
+
+// Reload 重新加载全部配置, 轮询从最新的version继续
+func (d *DataSource) Reload() error {
+	if err := d.db.DB().Ping(); err != nil {
+		return err
+	}
+	_, err := d.scan(structs.ConfTriggerReload)
+	return err
+}
+
+// Stop 进程退出停止轮询
+func (d *DataSource) Stop() {
+	select {
+	case <-d.stop:
+		return
+	default:
+		close(d.stop)
+	}
+	d.Close()
+	if err := d.db.Close(); err != nil {
+		xlog.Error("confProxy stop mysql error", xlog.String("msg", err.Error()))
+	}
+}
+
+// poll 轮询version字段获取变更的配置, 定期对比全部key
+func (d *DataSource) poll() {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	resync := time.NewTicker(d.resyncInterval)
+	defer resync.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.pollChanges()
+		case <-resync.C:
+			d.resync()
+		}
+	}
+}
+
+// pollChanges 下发version大于已处理version的配置, 按version顺序处理
+func (d *DataSource) pollChanges() {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+	items, err := d.listItems(d.HostKey(), d.getVersion())
+	d.polled(err)
+	if err != nil {
+		xlog.Error("mysql poll error", xlog.String("plugin", "confProxy"), xlog.String("msg", err.Error()))
+		return
+	}
+	for _, item := range items {
+		_, _ = d.apply(structs.ConfTriggerWatch, item)
+	}
+}
+
+// resync 轮询version无法感知删除的记录, 对比全部key下线已删除的配置, 并重试下发失败的配置
+func (d *DataSource) resync() {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+	keys, err := d.listKeys(d.HostKey())
+	d.polled(err)
+	if err != nil {
+		xlog.Error("mysql resync error", xlog.String("plugin", "confProxy"), xlog.String("msg", err.Error()))
+		return
+	}
+	d.Prune(structs.ConfTriggerWatch, keys)
+
+	d.mu.Lock()
+	failed := make([]string, 0, len(d.failed))
+	for key := range d.failed {
+		failed = append(failed, key)
+	}
+	d.mu.Unlock()
+	if len(failed) == 0 {
+		return
+	}
+	items, err := d.getItems(failed...)
+	if err != nil {
+		xlog.Error("mysql resync error", xlog.String("plugin", "confProxy"), xlog.String("msg", err.Error()))
+		return
+	}
+	for _, key := range failed {
+		item, ok := items[key]
+		if !ok {
+			// 配置已删除
+			d.mu.Lock()
+			delete(d.failed, key)
+			d.mu.Unlock()
+			continue
+		}
+		xlog.Info("mysql retry failed config", xlog.String("key", key), xlog.Int64("version", item.Version))
+		_, _ = d.apply(structs.ConfTriggerWatch, item)
+	}
+}
+
+// getItems 按key精确查询
+func (d *DataSource) getItems(keys ...string) (map[string]ConfItem, error) {
+	items := make([]ConfItem, 0)
+	if err := d.db.Table(d.table).Where("conf_key IN (?)", keys).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	res := make(map[string]ConfItem, len(items))
+	for _, item := range items {
+		res[item.Key] = item
+	}
+	return res, nil
+}
+
+// listKeys 查询前缀下的全部key
+func (d *DataSource) listKeys(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	if err := d.db.Table(d.table).Where("conf_key LIKE ?", prefix+"%").Pluck("conf_key", &keys).Error; err != nil {
+		return nil, err
+	}
+	res := keys[:0]
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			res = append(res, key)
+		}
+	}
+	return res, nil
+}
+
+// listItems 查询前缀下version大于指定值的配置
+func (d *DataSource) listItems(prefix string, version int64) ([]ConfItem, error) {
+	items := make([]ConfItem, 0)
+	err := d.db.Table(d.table).
+		Where("conf_key LIKE ? AND version > ?", prefix+"%", version).
+		Order("version asc").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	res := items[:0]
+	for _, item := range items {
+		// LIKE 中的 '_' 为通配符, 这里再次校验前缀
+		if strings.HasPrefix(item.Key, prefix) {
+			res = append(res, item)
+		}
+	}
+	return res, nil
+}
+
+func (d *DataSource) getVersion() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.version
+}
+
+// polled 记录轮询结果
+func (d *DataSource) polled(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status.Healthy = err == nil
+	if err != nil {
+		d.status.LastError = err.Error()
+		d.status.LastErrorAt = time.Now().Unix()
+	}
+}
+
+// Status 轮询状态, Revision 为已处理的最大version
+func (d *DataSource) Status() structs.WatchStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := d.status
+	status.Revision = d.version
+	return status
+}
@@ -0,0 +1,214 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/applier"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/cache"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/writer"
+	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	// sqlite driver
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// fakeReporter 记录上报的配置文件和状态
+type fakeReporter struct {
+	mu      sync.Mutex
+	reports []string
+}
+
+func (r *fakeReporter) Report(confKey structs.ConfKey, report structs.ConfReport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, confKey.FileName+":"+report.Status)
+	return nil
+}
+
+func (r *fakeReporter) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reports := r.reports
+	r.reports = nil
+	return reports
+}
+
+type testSource struct {
+	*DataSource
+	db       *gorm.DB
+	dir      string
+	reporter *fakeReporter
+}
+
+func newTestSource(t *testing.T) *testSource {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	assert.Nil(t, err)
+	// 内存数据库每个连接独立
+	db.DB().SetMaxOpenConns(1)
+	assert.Nil(t, db.Table(DefaultTable).CreateTable(&ConfItem{}).Error)
+	t.Cleanup(func() { db.Close() })
+
+	dir := t.TempDir()
+	reporter := &fakeReporter{}
+	config := applier.Config{
+		Prefix:   "/juno-agent",
+		Cache:    cache.New(filepath.Join(dir, "cache")),
+		Writer:   writer.New(1).WithDeletePolicy(writer.DeletePolicyRemove),
+		Reporter: reporter,
+	}
+	return &testSource{
+		DataSource: newDataSource(config, ConfDataSourceMysql{}, db),
+		db:         db,
+		dir:        dir,
+		reporter:   reporter,
+	}
+}
+
+func (s *testSource) key(file string) string {
+	return fmt.Sprintf("/juno-agent/%s/app1/dev/static/%s/9999", report.ReturnHostName(), file)
+}
+
+func (s *testSource) value(file, content string) string {
+	value := structs.ConfValue{Content: content, Metadata: structs.MetaData{
+		Timestamp: 1,
+		Version:   util.MD5(content),
+		Format:    "toml",
+		Paths:     []string{filepath.Join(s.dir, file)},
+	}}
+	buf, _ := json.Marshal(value)
+	return string(buf)
+}
+
+func (s *testSource) put(t *testing.T, file, content string, version int64) {
+	item := ConfItem{Key: s.key(file), Value: s.value(file, content), Version: version}
+	res := s.db.Table(DefaultTable).Where("conf_key = ?", item.Key).Updates(map[string]interface{}{"conf_value": item.Value, "version": version})
+	assert.Nil(t, res.Error)
+	if res.RowsAffected == 0 {
+		assert.Nil(t, s.db.Table(DefaultTable).Create(&item).Error)
+	}
+}
+
+func (s *testSource) read(file string) string {
+	content, _ := ioutil.ReadFile(filepath.Join(s.dir, file))
+	return string(content)
+}
+
+func TestDataSource_Poll(t *testing.T) {
+	s := newTestSource(t)
+	s.put(t, "a.toml", "a = 1\n", 1)
+	// 内容校验失败
+	s.put(t, "b.toml", "b = \n", 2)
+
+	nodes, err := s.scan(structs.ConfTriggerScanner)
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, "a = 1\n", s.read("a.toml"))
+	assert.Equal(t, int64(2), s.Status().Revision)
+	assert.Equal(t, []string{"a.toml:applied", "b.toml:validation-failed"}, s.reporter.take())
+
+	// 按version顺序下发, 与写入表的顺序无关
+	s.put(t, "a.toml", "a = 4\n", 4)
+	s.put(t, "c.toml", "c = 3\n", 3)
+	s.pollChanges()
+	assert.Equal(t, "a = 4\n", s.read("a.toml"))
+	assert.Equal(t, "c = 3\n", s.read("c.toml"))
+	assert.Equal(t, int64(4), s.Status().Revision)
+	assert.Equal(t, []string{"c.toml:applied", "a.toml:applied"}, s.reporter.take())
+	// 没有变化时不再下发
+	s.pollChanges()
+	assert.Empty(t, s.reporter.take())
+
+	// 下发失败的配置在对比时重试, version 没有变化
+	s.put(t, "b.toml", "b = 2\n", 2)
+	s.pollChanges()
+	assert.Empty(t, s.read("b.toml"))
+	s.resync()
+	assert.Equal(t, "b = 2\n", s.read("b.toml"))
+	assert.Equal(t, []string{"b.toml:applied"}, s.reporter.take())
+
+	// 删除的记录在对比时下线, 通知监听
+	ch := s.ListenAppConfig(nil, s.key("c.toml"))
+	assert.Nil(t, s.db.Table(DefaultTable).Where("conf_key = ?", s.key("c.toml")).Delete(ConfItem{}).Error)
+	s.resync()
+	assert.Empty(t, s.read("c.toml"))
+	assert.Equal(t, []string{"c.toml:deleted"}, s.reporter.take())
+	node := <-ch
+	assert.True(t, node.Deleted)
+	assert.Equal(t, "a = 4\n", s.read("a.toml"))
+
+	// 本地缓存中没有的配置不能确定写入过的文件, 下线失败
+	assert.NotNil(t, s.Delete(structs.ConfTriggerWatch, s.key("d.toml"), ""))
+	assert.Equal(t, []string{"d.toml:not-cached"}, s.reporter.take())
+	// 数据源提供下线前的配置时按照该配置处理
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(s.dir, "d.toml"), []byte("d = 1\n"), 0644))
+	assert.Nil(t, s.Delete(structs.ConfTriggerWatch, s.key("d.toml"), s.value("d.toml", "d = 1\n")))
+	assert.Empty(t, s.read("d.toml"))
+	assert.Equal(t, []string{"d.toml:deleted"}, s.reporter.take())
+}
+
+func TestDataSource_Reload(t *testing.T) {
+	s := newTestSource(t)
+	s.put(t, "a.toml", "a = 1\n", 1)
+	assert.Nil(t, s.Reload())
+	assert.Equal(t, "a = 1\n", s.read("a.toml"))
+
+	// 查询失败时返回错误, 不视为加载成功
+	assert.Nil(t, s.db.DropTable(DefaultTable).Error)
+	assert.NotNil(t, s.Reload())
+	assert.False(t, s.Status().Healthy)
+	assert.Equal(t, "a = 1\n", s.read("a.toml"))
+}
+
+func TestDataSource_GetRendered(t *testing.T) {
+	s := newTestSource(t)
+	content := "port = {{ .Port }}\n"
+	value, _ := json.Marshal(structs.ConfValue{Content: content, Metadata: structs.MetaData{
+		Timestamp: 1,
+		Version:   util.MD5(content),
+		Format:    "toml",
+		Template:  true,
+		Paths:     []string{filepath.Join(s.dir, "t.toml")},
+	}})
+	item := ConfItem{Key: s.key("t.toml"), Value: string(value), Version: 1}
+	assert.Nil(t, s.db.Table(DefaultTable).Create(&item).Error)
+	_, err := s.scan(structs.ConfTriggerScanner)
+	assert.Nil(t, err)
+	assert.Equal(t, "port = 9999\n", s.read("t.toml"))
+
+	// 读取接口返回与磁盘上一致的渲染后内容
+	res, err := s.GetRawValues(nil, s.key("t.toml"))
+	assert.Nil(t, err)
+	assert.Equal(t, "port = 9999\n", res[s.key("t.toml")].Content)
+	res, err = s.GetValues(nil, "app1", "dev", "t.toml", "9999")
+	assert.Nil(t, err)
+	for _, config := range res {
+		assert.Equal(t, "port = 9999\n", config.Content)
+	}
+	layers, err := s.GetLayers(nil, "app1", "dev")
+	assert.Nil(t, err)
+	assert.Len(t, layers, 1)
+	assert.Equal(t, "port = 9999\n", layers[0].Value.Content)
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"time"
+)
+
+const (
+	// DefaultTable 默认配置表
+	DefaultTable = "juno_agent_config"
+	// DefaultPollInterval 默认轮询version字段的间隔
+	DefaultPollInterval = time.Second * 5
+	// DefaultResyncInterval 默认对比全部key的间隔
+	DefaultResyncInterval = time.Minute
+)
+
+// ConfDataSourceMysql mysql dataSource
+type ConfDataSourceMysql struct {
+	Enable       bool          // 是否开启用该数据源
+	Dsn          string        `json:"dsn"`
+	Table        string        `json:"table"`        // 配置表名称
+	PollInterval time.Duration `json:"pollInterval"` // 轮询version字段的间隔
+	// 对比全部key的间隔, 下线已删除的配置并重试下发失败的配置
+	ResyncInterval time.Duration `json:"resyncInterval"`
+}
+
+// ConfItem 配置中心发布到mysql的配置, key/value 与etcd数据源的格式保持一致
+// version 在每次发布时递增, agent 通过轮询 version 感知配置变更, 通过定期对比全部key感知配置删除
+type ConfItem struct {
+	ID        uint64    `gorm:"primary_key;column:id"`
+	Key       string    `gorm:"column:conf_key;type:varchar(512);unique_index"`
+	Value     string    `gorm:"column:conf_value;type:longtext"`
+	Version   int64     `gorm:"column:version;index"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
@@ -16,34 +16,84 @@ package confProxy
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/applier"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/audit"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/cache"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/drift"
 	"github.com/douyu/juno-agent/pkg/proxy/confProxy/etcd"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/hook"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/keyring"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/mysql"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/render"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/writer"
 	"github.com/douyu/jupiter/pkg/conf"
 	"github.com/douyu/jupiter/pkg/flag"
 	"github.com/douyu/jupiter/pkg/xlog"
-	"github.com/spf13/cast"
 )
 
 // DefaultConfDir ...
 var DefaultConfDir = "/home/www/.config/juno-agent"
 
+// DefaultPrefix 配置中心key的默认前缀
+var DefaultPrefix = "/juno-agent"
+
+// DefaultTimeout 请求etcd的默认超时时间
+var DefaultTimeout = time.Second * 3
+
+const (
+	// DataSourceEtcd ...
+	DataSourceEtcd = "etcd"
+	// DataSourceMysql ...
+	DataSourceMysql = "mysql"
+)
+
+func init() {
+	RegisterDataSource(DataSourceEtcd, func(c *Config) (DataSource, error) {
+		return etcd.NewETCDDataSource(c.applier(), c.Timeout), nil
+	})
+	RegisterDataSource(DataSourceMysql, func(c *Config) (DataSource, error) {
+		return mysql.NewMySQLDataSource(c.applier(), c.Mysql)
+	})
+}
+
 // Config confProxy config
 type Config struct {
 	Dir     string        `json:"dir"` // 配置中心具体配置路径
 	Prefix  string        `json:"prefix"`
 	Env     []string      `json:"env"`
-	Timeout time.Duration // etcd连接超时时间
+	Timeout time.Duration // 每次请求etcd的超时时间, 包括读取配置和上报下发状态
 	Secure  bool
-	Enable  bool                // 是否开启开插件
-	Mysql   ConfDataSourceMysql `json:"mysql"`
+	Enable  bool                    // 是否开启开插件
+	Mysql   ConfDataSourceMysql     `json:"mysql"`
+	Etcd    etcd.ConfDataSourceEtcd `json:"etcd"`
+	Backup  int                     `json:"backup"` // 配置文件保留的历史版本数量
+	Hooks   []hook.Rule             `json:"hooks"`  // 配置文件写入后执行的动作
+	// 配置下线时对已写入文件的处理策略: keep/remove/archive
+	DeletePolicy string `json:"deletePolicy"`
+	// 解密 Metadata.Encoded 配置内容的密钥
+	Encrypt keyring.Config `json:"encrypt"`
+	// 渲染 Metadata.Template 配置内容
+	Template render.Config `json:"template"`
+	// 检查已写入的配置文件是否被手动修改或删除
+	Drift drift.Config `json:"drift"`
+	// 配置下发审计记录
+	Audit audit.Config `json:"audit"`
+
+	cache    *cache.Cache
+	writer   *writer.Writer
+	hooks    *hook.Hooks
+	keys     *keyring.Ring
+	renderer *render.Renderer
+	drift    *drift.Detector
+	audit    *audit.Log
 }
 
 // ConfDataSourceMysql mysql dataSource
-type ConfDataSourceMysql struct {
-	Enable bool   // 是否开启用该数据源
-	Dsn    string `json:"dsn"`
-}
+type ConfDataSourceMysql = mysql.ConfDataSourceMysql
 
 // StdConfig 返回标准配置信息
 func StdConfig(key string) *Config {
@@ -76,20 +126,109 @@ func RawConfig(key string) *Config {
 // DefaultConfig default config info
 func DefaultConfig() Config {
 	return Config{
-		Dir:     DefaultConfDir,
-		Timeout: cast.ToDuration("1s"),
-		Enable:  false,
+		Dir:          DefaultConfDir,
+		Prefix:       DefaultPrefix,
+		Timeout:      DefaultTimeout,
+		Enable:       false,
+		Backup:       writer.DefaultBackup,
+		DeletePolicy: writer.DeletePolicyKeep,
 		Mysql: ConfDataSourceMysql{
-			Enable: false,
-			Dsn:    "127.0.0.1:6379",
+			Enable:       false,
+			Dsn:          "",
+			Table:        mysql.DefaultTable,
+			PollInterval: mysql.DefaultPollInterval,
+		},
+		Etcd: etcd.ConfDataSourceEtcd{
+			Enable: true,
 		},
+		Audit: audit.Config{
+			Enable:     true,
+			MaxSize:    audit.DefaultMaxSize,
+			MaxBackups: audit.DefaultMaxBackups,
+		},
+	}
+}
+
+// CacheDir 本地缓存目录
+func (c *Config) CacheDir() string {
+	return filepath.Join(c.Dir, "cache")
+}
+
+// AuditDir 配置下发审计记录目录
+func (c *Config) AuditDir() string {
+	return filepath.Join(c.Dir, "audit")
+}
+
+// WithCache 使用已预热的本地缓存
+func (c *Config) WithCache(localCache *cache.Cache) *Config {
+	c.cache = localCache
+	return c
+}
+
+// applier 数据源共用的配置下发组件
+func (c *Config) applier() applier.Config {
+	var reporter applier.Reporter
+	// 下发状态统一写入etcd的callback key, mysql数据源同样上报, 关闭etcd时不上报
+	if c.Etcd.Enable {
+		reporter = etcd.NewReporter(c.Prefix, c.Timeout)
+	}
+	return applier.Config{
+		Prefix:   c.Prefix,
+		Env:      c.Env,
+		Cache:    c.cache,
+		Writer:   c.writer,
+		Hooks:    c.hooks,
+		Keys:     c.keys,
+		Renderer: c.renderer,
+		Drift:    c.drift,
+		Audit:    c.audit,
+		Reporter: reporter,
+	}
+}
+
+// DataSource 根据配置选择数据源, mysql开启时优先使用mysql
+func (c *Config) DataSource() string {
+	if c.Mysql.Enable {
+		return DataSourceMysql
 	}
+	return DataSourceEtcd
 }
 
 // Build  new the instance
 func (c *Config) Build() *ConfProxy {
 	if c.Enable {
-		return NewConfProxy(c.Enable, etcd.NewETCDDataSource(c.Prefix))
+		// 不同的agent集群可以使用不同的前缀共用一个etcd
+		if c.Prefix = strings.Trim(c.Prefix, "/"); c.Prefix == "" {
+			c.Prefix = DefaultPrefix
+		} else {
+			c.Prefix = "/" + c.Prefix
+		}
+		if c.Timeout <= 0 {
+			c.Timeout = DefaultTimeout
+		}
+		if c.cache == nil {
+			c.cache = cache.New(c.CacheDir())
+		}
+		c.writer = writer.New(c.Backup).WithDeletePolicy(c.DeletePolicy)
+		c.hooks = hook.New(c.Hooks)
+		c.keys = keyring.New(c.Encrypt)
+		c.renderer = render.New(c.Template)
+		c.drift = drift.New(c.Drift, c.writer)
+		c.audit = audit.New(c.Audit, c.AuditDir())
+		dataSource, err := buildDataSource(c.DataSource(), c)
+		if err != nil {
+			xlog.Panic("confProxy", xlog.String("dataSource", c.DataSource()), xlog.String("build dataSource err", err.Error()))
+		}
+		confProxy := NewConfProxy(c.Enable, dataSource)
+		confProxy.prefix = c.Prefix
+		confProxy.source = c.DataSource()
+		confProxy.writer = c.writer
+		confProxy.hooks = c.hooks
+		confProxy.drift = c.drift
+		confProxy.audit = c.audit
+		confProxy.cache = c.cache
+		c.drift.Start()
+		return confProxy
 	}
 	return nil
 }
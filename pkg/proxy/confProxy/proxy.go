@@ -16,10 +16,21 @@ package confProxy
 
 import (
 	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/douyu/juno-agent/util"
 	"github.com/labstack/echo/v4"
-	"time"
 
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/audit"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/cache"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/drift"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/hook"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/writer"
+	"github.com/douyu/juno-agent/pkg/report"
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/douyu/jupiter/pkg/xlog"
 )
@@ -29,6 +40,21 @@ type ConfProxy struct {
 	enable     bool
 	dataSource DataSource
 	nodeInput  chan *structs.ConfNode
+	writer     *writer.Writer
+	hooks      *hook.Hooks
+	drift      *drift.Detector
+	audit      *audit.Log
+	cache      *cache.Cache
+	prefix     string
+	// 数据源名称, etcd/mysql
+	source string
+
+	// 同一时间只执行一次重新加载
+	reloadMu sync.Mutex
+	statusMu sync.Mutex
+	reload   structs.ConfReloadStatus
+
+	closeOnce sync.Once
 }
 
 // NewConfProxy new instance
@@ -53,9 +79,23 @@ func (cp *ConfProxy) Start() {
 	}
 }
 
-// Close ...
+// Close 停止数据源的监听, 关闭后 C() 被关闭
 func (cp *ConfProxy) Close() {
-	close(cp.nodeInput)
+	cp.closeOnce.Do(func() {
+		cp.drift.Stop()
+		// 先停止动作的执行, 动作完成后的上报在数据源关闭前发送
+		cp.hooks.Stop()
+		cp.dataSource.Stop()
+		if err := cp.audit.Close(); err != nil {
+			xlog.Error("confProxy audit close error", xlog.String("err", err.Error()))
+		}
+		close(cp.nodeInput)
+	})
+}
+
+// Prefix 配置中心key的前缀
+func (cp *ConfProxy) Prefix() string {
+	return cp.prefix
 }
 
 // C ...
@@ -64,94 +104,322 @@ func (cp *ConfProxy) C() <-chan *structs.ConfNode {
 }
 
 // GetValues ...
+// 配置中心不可用时返回本地缓存的数据, 同时返回 cache.ErrStale
 func (cp *ConfProxy) GetValues(ctx echo.Context, appName, appEnv, target, port string) (config string, err error) {
+	value, err := cp.GetConfValue(ctx, appName, appEnv, target, port)
+	if err != nil && !IsStale(err) {
+		return "nil", err
+	}
+	return value.Content, err
+}
+
+// GetRawValues ...
+func (cp *ConfProxy) GetRawValues(ctx echo.Context, rawKey string) (config string, err error) {
+	value, err := cp.GetRawConfValue(ctx, rawKey)
+	if err != nil && !IsStale(err) {
+		return "nil", err
+	}
+	return value.Content, err
+}
+
+// GetConfValue 返回配置内容以及版本信息
+func (cp *ConfProxy) GetConfValue(ctx echo.Context, appName, appEnv, target, port string) (structs.ConfValue, error) {
 	data, err := cp.dataSource.GetValues(ctx, appName, appEnv, target, port)
 	commonKey := util.GetConfigKey(appName, appEnv, target, port)
-	if err != nil {
-		return "nil", err
+	if err != nil && !IsStale(err) {
+		return structs.ConfValue{}, err
 	}
-	if len(data[commonKey]) > 0 {
-		return data[commonKey], nil
+	if value, ok := data[commonKey]; ok && len(value.Content) > 0 {
+		return value, err
 	}
 
-	return "nil", errors.New("unknown config")
+	return structs.ConfValue{}, errors.New("unknown config")
 }
 
-// GetRawValues ...
-func (cp *ConfProxy) GetRawValues(ctx echo.Context, rawKey string) (config string, err error) {
+// GetRawConfValue 通过原生key返回配置内容以及版本信息
+func (cp *ConfProxy) GetRawConfValue(ctx echo.Context, rawKey string) (structs.ConfValue, error) {
 	data, err := cp.dataSource.GetRawValues(ctx, rawKey)
-	if err != nil {
-		return "nil", err
+	if err != nil && !IsStale(err) {
+		return structs.ConfValue{}, err
 	}
-	if len(data[rawKey]) > 0 {
-		return data[rawKey], nil
+	if value, ok := data[rawKey]; ok && len(value.Content) > 0 {
+		return value, err
 	}
 
-	return "nil", errors.New("unknown config")
+	return structs.ConfValue{}, errors.New("unknown config")
 }
 
-// ListenAppConfig ...
-func (cp *ConfProxy) ListenAppConfig(ctx echo.Context, appName, appEnv, target, port string, watch bool, internal int) (structs.ContentNode, error) {
+// ListenAppConfig 长轮训监听配置变化
+// version 为客户端已知的配置版本或MD5, 与当前版本不一致时立即返回, 否则等待新的版本直到超时
+func (cp *ConfProxy) ListenAppConfig(ctx echo.Context, appName, appEnv, target, port string, watch bool, internal int, version string) (structs.ContentNode, error) {
 	commonKey := util.GetConfigKey(appName, appEnv, target, port)
-	switch watch {
-	case true:
-		ch := cp.dataSource.ListenAppConfig(ctx, commonKey)
+	return cp.listen(ctx, commonKey, watch, internal, version, func() (structs.ConfValue, error) {
+		return cp.GetConfValue(ctx, appName, appEnv, target, port)
+	})
+}
+
+// ListenRawKeyAppConfig ...
+func (cp *ConfProxy) ListenRawKeyAppConfig(ctx echo.Context, rawKey string, watch bool, internal int, version string) (structs.ContentNode, error) {
+	return cp.listen(ctx, rawKey, watch, internal, version, func() (structs.ConfValue, error) {
+		return cp.GetRawConfValue(ctx, rawKey)
+	})
+}
+
+func (cp *ConfProxy) listen(ctx echo.Context, key string, watch bool, internal int, version string, get func() (structs.ConfValue, error)) (structs.ContentNode, error) {
+	if !watch {
+		value, err := get()
+		if err != nil && !IsStale(err) {
+			return structs.ContentNode{}, err
+		}
+		node := value.ContentNode()
+		node.Stale = IsStale(err)
+		return node, nil
+	}
+
+	timeout := time.After(time.Second * time.Duration(internal))
+	for {
+		// 先注册监听再比较版本, 比较之后发生的变更同样会通知到监听
+		ch := cp.dataSource.ListenAppConfig(ctx, key)
+		if version != "" {
+			if value, err := get(); err == nil && !sameVersion(version, value.Metadata.Version, value.Content) {
+				cp.dataSource.RemoveListener(key, ch)
+				return value.ContentNode(), nil
+			}
+		}
 		select {
-		case info := <-ch:
-			if info.Configuration != nil {
-				return structs.ContentNode{
-					Content: info.Configuration.Content,
-					Version: time.Now().Unix(),
-				}, nil
+		case info, ok := <-ch:
+			if !ok || info == nil {
+				continue
+			}
+			if info.Deleted {
+				return structs.ContentNode{Deleted: true, Timestamp: time.Now().Unix()}, nil
+			}
+			if info.Configuration == nil {
+				return structs.ContentNode{}, errors.New("get app config nil")
+			}
+			if version != "" && sameVersion(version, info.Configuration.Metadata.Version, info.Configuration.Content) {
+				// 版本没有变化, 继续等待
+				continue
 			}
-			return structs.ContentNode{}, errors.New("get app config nil")
-		case <-time.After(time.Second * time.Duration(internal)):
+			return info.Configuration.ContentNode(), nil
+		case <-timeout:
+			cp.dataSource.RemoveListener(key, ch)
+			return structs.ContentNode{}, errors.New("no change")
+		case <-requestDone(ctx):
+			cp.dataSource.RemoveListener(key, ch)
+			return structs.ContentNode{}, errors.New("request canceled")
 		}
-		return structs.ContentNode{}, errors.New("no change")
-	default:
-		content, err := cp.GetValues(ctx, appName, appEnv, target, port)
-		if err != nil {
-			return structs.ContentNode{}, err
+	}
+}
+
+// WatchConfig 订阅配置变化, 订阅后先推送当前的配置, 之后推送每一次变化, 调用 cancel 取消订阅
+// keys 为 util.GetConfigKey 生成的应用配置key, rawKeys 为原生key
+func (cp *ConfProxy) WatchConfig(ctx echo.Context, keys, rawKeys []string) (<-chan structs.ConfEvent, func()) {
+	var (
+		out  = make(chan structs.ConfEvent, len(keys)+len(rawKeys))
+		stop = make(chan struct{})
+		once sync.Once
+		wg   sync.WaitGroup
+		subs = make(map[string]chan *structs.ConfNode)
+	)
+	for _, key := range append(append([]string{}, keys...), rawKeys...) {
+		if _, ok := subs[key]; ok {
+			continue
+		}
+		ch := make(chan *structs.ConfNode, 1)
+		subs[key] = ch
+		cp.dataSource.Subscribe(key, ch)
+	}
+
+	// 先订阅再获取当前配置, 获取期间的变化不会丢失
+	send := func(event structs.ConfEvent) bool {
+		select {
+		case out <- event:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	snapshot := func(key string, raw bool) (structs.ConfValue, error) {
+		if raw {
+			return cp.GetRawConfValue(ctx, key)
 		}
-		return structs.ContentNode{
-			Content: content,
-			Version: time.Now().Unix(),
-		}, nil
+		arr := strings.Split(key, "/")
+		if len(arr) != 4 {
+			return structs.ConfValue{}, fmt.Errorf("invalid config key: %s", key)
+		}
+		return cp.GetConfValue(ctx, arr[0], arr[1], arr[2], arr[3])
+	}
+	for _, key := range keys {
+		wg.Add(1)
+		go cp.forward(key, subs[key], stop, &wg, send, func() (structs.ConfValue, error) { return snapshot(key, false) })
 	}
+	for _, key := range rawKeys {
+		wg.Add(1)
+		go cp.forward(key, subs[key], stop, &wg, send, func() (structs.ConfValue, error) { return snapshot(key, true) })
+	}
+
+	cancel := func() {
+		once.Do(func() {
+			close(stop)
+			for key, ch := range subs {
+				cp.dataSource.RemoveListener(key, ch)
+			}
+			wg.Wait()
+			close(out)
+		})
+	}
+	return out, cancel
 }
 
-// ListenRawKeyAppConfig ...
-func (cp *ConfProxy) ListenRawKeyAppConfig(ctx echo.Context, rawKey string, watch bool, internal int) (structs.ContentNode, error) {
-	switch watch {
-	case true:
-		ch := cp.dataSource.ListenAppConfig(ctx, rawKey)
+// forward 推送订阅key的当前配置以及之后的变化
+func (cp *ConfProxy) forward(key string, ch chan *structs.ConfNode, stop chan struct{}, wg *sync.WaitGroup,
+	send func(structs.ConfEvent) bool, get func() (structs.ConfValue, error)) {
+	defer wg.Done()
+	if value, err := get(); err == nil || IsStale(err) {
+		node := value.ContentNode()
+		node.Stale = IsStale(err)
+		if !send(structs.ConfEvent{Key: key, ContentNode: node}) {
+			return
+		}
+	}
+	for {
 		select {
 		case info := <-ch:
-			if info.Configuration != nil {
-				return structs.ContentNode{
-					Content: info.Configuration.Content,
-					Version: time.Now().Unix(),
-				}, nil
+			event := structs.ConfEvent{Key: key}
+			switch {
+			case info.Deleted:
+				event.Deleted = true
+				event.Timestamp = time.Now().Unix()
+			case info.Configuration != nil:
+				event.ContentNode = info.Configuration.ContentNode()
+			default:
+				continue
 			}
-			return structs.ContentNode{}, errors.New("get raw key, app config nil")
-		case <-time.After(time.Second * time.Duration(internal)):
+			if !send(event) {
+				return
+			}
+		case <-stop:
+			return
 		}
-		return structs.ContentNode{}, errors.New("no change")
-	default:
-		content, err := cp.GetRawValues(ctx, rawKey)
+	}
+}
+
+// sameVersion 客户端传入的版本可以是配置中心发布的版本, 也可以是配置内容的MD5
+func sameVersion(version, current, content string) bool {
+	return version == current || version == util.MD5(content)
+}
+
+// requestDone 客户端断开连接时关闭
+func requestDone(ctx echo.Context) <-chan struct{} {
+	if ctx == nil || ctx.Request() == nil {
+		return nil
+	}
+	return ctx.Request().Context().Done()
+}
+
+// IsStale 数据是否来自本地缓存
+func IsStale(err error) bool {
+	return errors.Is(err, cache.ErrStale)
+}
+
+// Reload 重新加载全部配置并重新监听, 并发调用时依次执行
+func (cp *ConfProxy) Reload() error {
+	cp.reloadMu.Lock()
+	defer cp.reloadMu.Unlock()
+	cp.statusMu.Lock()
+	cp.reload.Reloading = true
+	cp.statusMu.Unlock()
+
+	err := cp.dataSource.Reload()
+
+	cp.statusMu.Lock()
+	defer cp.statusMu.Unlock()
+	cp.reload.Reloading = false
+	cp.reload.Reloads++
+	cp.reload.LastReloadAt = time.Now().Unix()
+	cp.reload.LastReloadError = ""
+	if err != nil {
+		cp.reload.LastReloadError = err.Error()
+	}
+	return err
+}
+
+// ReloadStatus 返回数据源的监听状态以及最后一次重新加载的结果
+func (cp *ConfProxy) ReloadStatus() structs.ConfReloadStatus {
+	cp.statusMu.Lock()
+	status := cp.reload
+	cp.statusMu.Unlock()
+	status.DataSource = cp.source
+	status.Watch = cp.dataSource.Status()
+	return status
+}
+
+// ErrUnmanagedPath 文件不是本机当前下发的配置写入的
+var ErrUnmanagedPath = errors.New("path is not managed by confProxy")
+
+// ConfigVersions 返回配置文件的历史版本
+func (cp *ConfProxy) ConfigVersions(path string) ([]writer.Version, error) {
+	if !cp.managed(path) {
+		return nil, ErrUnmanagedPath
+	}
+	return cp.writer.Versions(path)
+}
+
+// Rollback 将配置文件恢复到指定的历史版本
+// 回滚后以回滚的内容为准, 不再视为不一致
+func (cp *ConfProxy) Rollback(path, version string) (writer.Version, error) {
+	if !cp.managed(path) {
+		return writer.Version{}, ErrUnmanagedPath
+	}
+	target, err := cp.writer.Rollback(path, version)
+	cp.audit.RecordRollback(path, target.MD5, err)
+	if err != nil {
+		return target, err
+	}
+	if err := cp.drift.Accept(path); err != nil {
+		xlog.Error("confProxy drift accept error", xlog.String("path", path), xlog.String("err", err.Error()))
+	}
+	return target, nil
+}
+
+// managed 文件是否由本机当前下发的配置写入, 只有这些文件允许查看历史版本和回滚
+func (cp *ConfProxy) managed(path string) bool {
+	if cp.cache == nil || path == "" {
+		return false
+	}
+	path = filepath.Clean(path)
+	hostKey := strings.Join([]string{cp.prefix, report.ReturnHostName()}, "/") + "/"
+	for _, entry := range cp.cache.List(hostKey) {
+		value, err := entry.ConfValue()
 		if err != nil {
-			return structs.ContentNode{}, err
+			continue
+		}
+		for _, managed := range value.Metadata.Paths {
+			if filepath.Clean(managed) == path {
+				return true
+			}
 		}
-		return structs.ContentNode{
-			Content: content,
-			Version: time.Now().Unix(),
-		}, nil
 	}
+	return false
 }
 
-// Reload ...
-func (cp *ConfProxy) Reload() error {
-	return cp.dataSource.Reload()
+// History 查询配置下发审计记录, 从新到旧
+func (cp *ConfProxy) History(query audit.Query) ([]structs.ConfAudit, error) {
+	return cp.audit.Query(query)
+}
+
+// Drifts 返回与最后一次下发的内容不一致的配置文件, scan 为 true 时立即检查
+func (cp *ConfProxy) Drifts(scan bool) []structs.ConfDrift {
+	if scan {
+		return cp.drift.Scan()
+	}
+	return cp.drift.Drifts()
+}
+
+// SetProgramResolver 设置配置文件与 supervisor/systemd 程序的对应关系, 用于配置写入后执行动作
+func (cp *ConfProxy) SetProgramResolver(resolver hook.Resolver) {
+	cp.hooks.SetResolver(resolver)
 }
 
 // extractConfNode ...
@@ -0,0 +1,281 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confProxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/audit"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/cache"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/drift"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/writer"
+	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRawKey = "/juno-agent/cluster/demo/dev/static/config.toml"
+
+// fakeDataSource 内存数据源
+type fakeDataSource struct {
+	mu        sync.Mutex
+	values    map[string]structs.ConfValue
+	listeners map[string][]chan *structs.ConfNode
+	// 订阅的监听通知后不关闭
+	subscribers map[string][]chan *structs.ConfNode
+	layers      []structs.ConfLayer
+}
+
+func newFakeDataSource() *fakeDataSource {
+	return &fakeDataSource{
+		values:      make(map[string]structs.ConfValue),
+		listeners:   make(map[string][]chan *structs.ConfNode),
+		subscribers: make(map[string][]chan *structs.ConfNode),
+	}
+}
+
+func (f *fakeDataSource) ListenAppConfig(ctx echo.Context, key string) chan *structs.ConfNode {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan *structs.ConfNode, 1)
+	f.listeners[key] = append(f.listeners[key], ch)
+	return ch
+}
+
+func (f *fakeDataSource) Subscribe(key string, ch chan *structs.ConfNode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers[key] = append(f.subscribers[key], ch)
+}
+
+func (f *fakeDataSource) RemoveListener(key string, ch chan *structs.ConfNode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, listeners := range []map[string][]chan *structs.ConfNode{f.listeners, f.subscribers} {
+		chs := listeners[key]
+		for i := range chs {
+			if chs[i] == ch {
+				listeners[key] = append(chs[:i], chs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (f *fakeDataSource) GetValues(ctx echo.Context, keys ...string) (map[string]structs.ConfValue, error) {
+	return map[string]structs.ConfValue{}, nil
+}
+
+func (f *fakeDataSource) GetRawValues(ctx echo.Context, rawKey string) (map[string]structs.ConfValue, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return map[string]structs.ConfValue{rawKey: f.values[rawKey]}, nil
+}
+
+func (f *fakeDataSource) GetLayers(ctx echo.Context, appName, appEnv string) ([]structs.ConfLayer, error) {
+	return f.layers, nil
+}
+
+func (f *fakeDataSource) AppConfigScanner() []*structs.ConfNode { return nil }
+func (f *fakeDataSource) Reload() error                         { return nil }
+func (f *fakeDataSource) Status() structs.WatchStatus           { return structs.WatchStatus{Healthy: true} }
+func (f *fakeDataSource) Stop()                                 {}
+
+// publish 发布新版本并通知监听
+func (f *fakeDataSource) publish(key, content, version string) {
+	value := structs.ConfValue{Content: content, Metadata: structs.MetaData{Version: version, Format: "toml", Timestamp: time.Now().Unix()}}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[key] = value
+	node := &structs.ConfNode{Configuration: &structs.AppConfiguration{
+		Content:  value.Content,
+		Metadata: structs.Metadata{Version: version, Format: value.Metadata.Format, Timestamp: value.Metadata.Timestamp},
+	}}
+	for _, ch := range f.listeners[key] {
+		ch <- node
+		close(ch)
+	}
+	delete(f.listeners, key)
+	for _, ch := range f.subscribers[key] {
+		ch <- node
+	}
+}
+
+func (f *fakeDataSource) listenerCount(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.listeners[key]) + len(f.subscribers[key])
+}
+
+func TestConfProxy_ListenVersion(t *testing.T) {
+	ds := newFakeDataSource()
+	cp := NewConfProxy(true, ds)
+	ds.publish(testRawKey, "a=1", "v1")
+
+	// 客户端版本落后, 立即返回当前版本
+	node, err := cp.ListenRawKeyAppConfig(nil, testRawKey, true, 1, "v0")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", node.Version)
+	assert.Equal(t, "toml", node.Format)
+	assert.Equal(t, "a=1", node.Content)
+	assert.Equal(t, 0, ds.listenerCount(testRawKey))
+
+	// 客户端版本为最新, 等待新版本
+	go func() {
+		for ds.listenerCount(testRawKey) == 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+		ds.publish(testRawKey, "a=2", "v2")
+	}()
+	node, err = cp.ListenRawKeyAppConfig(nil, testRawKey, true, 5, "v1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", node.Version)
+	assert.Equal(t, "a=2", node.Content)
+
+	// 超时后移除监听
+	_, err = cp.ListenRawKeyAppConfig(nil, testRawKey, true, 1, "v2")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, ds.listenerCount(testRawKey))
+}
+
+func TestConfProxy_WatchConfig(t *testing.T) {
+	ds := newFakeDataSource()
+	cp := NewConfProxy(true, ds)
+	ds.publish(testRawKey, "a=1", "v1")
+
+	events, cancel := cp.WatchConfig(nil, nil, []string{testRawKey})
+	// 先推送当前的配置
+	event := <-events
+	assert.Equal(t, testRawKey, event.Key)
+	assert.Equal(t, "v1", event.Version)
+
+	for _, version := range []string{"v2", "v3"} {
+		ds.publish(testRawKey, "a="+version, version)
+		event = <-events
+		assert.Equal(t, version, event.Version)
+		assert.Equal(t, "a="+version, event.Content)
+	}
+
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.Equal(t, 0, ds.listenerCount(testRawKey))
+}
+
+func TestConfProxy_GetBundle(t *testing.T) {
+	layer := func(scope, file, port, content string, timestamp int64) structs.ConfLayer {
+		return structs.ConfLayer{Scope: scope, FileName: file, Port: port, Value: structs.ConfValue{
+			Content:  content,
+			Metadata: structs.MetaData{Version: content, Format: "toml", Timestamp: timestamp},
+			Scope:    scope,
+		}}
+	}
+	ds := newFakeDataSource()
+	ds.layers = []structs.ConfLayer{
+		layer("host-1", "config.toml", "8023", "a = 3\n", 3),
+		layer("host-1", "config.toml", "8024", "a = 4\n", 4),
+		layer(structs.ZoneScope("HB"), "config.toml", "", "b = 2\n", 2),
+		layer(structs.RegionScope("WUHAN"), "config.toml", "", "b = 1\nd = 1\n", 2),
+		layer(structs.ScopeCluster, "config.toml", "", "a = 1\nc = 1\n", 1),
+		layer(structs.ScopeCluster, "log.toml", "", "level = \"info\"\n", 1),
+	}
+	cp := NewConfProxy(true, ds)
+
+	// host覆盖cluster
+	bundle, err := cp.GetBundle(nil, "demo", "dev", "8023", false)
+	assert.Nil(t, err)
+	assert.Len(t, bundle, 2)
+	assert.Equal(t, "a = 3\n", bundle["config.toml"].Content)
+	assert.Equal(t, []string{"host-1"}, bundle["config.toml"].Scopes)
+	assert.Equal(t, "host-1", bundle["config.toml"].Scope)
+	assert.Equal(t, []string{structs.ScopeCluster}, bundle["log.toml"].Scopes)
+
+	// 未指定端口时使用最新发布的host配置
+	bundle, err = cp.GetBundle(nil, "demo", "dev", "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "a = 4\n", bundle["config.toml"].Content)
+
+	// cluster -> region -> zone -> host 合并
+	bundle, err = cp.GetBundle(nil, "demo", "dev", "8023", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "a = 3\nb = 2\nc = 1\nd = 1\n", bundle["config.toml"].Content)
+	assert.Equal(t, []string{structs.ScopeCluster, structs.RegionScope("WUHAN"), structs.ZoneScope("HB"), "host-1"}, bundle["config.toml"].Scopes)
+	assert.Equal(t, int64(3), bundle["config.toml"].Timestamp)
+}
+
+func TestConfProxy_ReloadStatus(t *testing.T) {
+	cp := NewConfProxy(true, newFakeDataSource())
+	assert.Equal(t, 0, cp.ReloadStatus().Reloads)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, cp.Reload())
+		}()
+	}
+	wg.Wait()
+	status := cp.ReloadStatus()
+	assert.Equal(t, 3, status.Reloads)
+	assert.False(t, status.Reloading)
+	assert.True(t, status.Watch.Healthy)
+	assert.NotZero(t, status.LastReloadAt)
+}
+
+func TestConfProxy_Rollback(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	cp := NewConfProxy(true, newFakeDataSource())
+	cp.prefix = DefaultPrefix
+	cp.cache = cache.New(filepath.Join(dir, "cache"))
+	cp.writer = writer.New(writer.DefaultBackup)
+	cp.drift = drift.New(drift.Config{}, cp.writer)
+	cp.audit = audit.New(audit.Config{}, filepath.Join(dir, "audit"))
+
+	for _, content := range []string{"a = 1", "a = 2"} {
+		_, err := cp.writer.Write(path, content, "")
+		assert.Nil(t, err)
+	}
+	value, _ := json.Marshal(structs.ConfValue{Content: "a = 2", Metadata: structs.MetaData{
+		Timestamp: 1,
+		Version:   util.MD5("a = 2"),
+		Format:    "toml",
+		Paths:     []string{path},
+	}})
+	key := DefaultPrefix + "/" + report.ReturnHostName() + "/demo/dev/static/config.toml/9999"
+
+	// 不是下发的配置写入的文件不允许查看和回滚
+	_, err := cp.ConfigVersions(path)
+	assert.Equal(t, ErrUnmanagedPath, err)
+	_, err = cp.Rollback("/etc/passwd", "")
+	assert.Equal(t, ErrUnmanagedPath, err)
+
+	assert.Nil(t, cp.cache.Put(key, string(value)))
+	versions, err := cp.ConfigVersions(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(versions))
+	_, err = cp.Rollback(path, "")
+	assert.Nil(t, err)
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "a = 1", string(content))
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/juno-agent/pkg/structs"
+)
+
+// Facts 渲染模板时可以使用的主机信息
+type Facts struct {
+	Hostname   string
+	IP         string
+	RegionCode string
+	RegionName string
+	ZoneCode   string
+	ZoneName   string
+	Port       string
+	App        string
+	Env        string
+	File       string
+}
+
+// HostFacts 返回本机信息以及配置key中的应用信息
+func HostFacts(keys structs.ConfKey) Facts {
+	facts := Facts{
+		Hostname: report.ReturnHostName(),
+		IP:       report.ReturnAppIp(),
+		Port:     keys.Port,
+		App:      keys.AppName,
+		Env:      keys.EnvName,
+		File:     keys.FileName,
+	}
+	facts.RegionCode, facts.RegionName = report.ReturnRegion()
+	facts.ZoneCode, facts.ZoneName = report.ReturnZone()
+	return facts
+}
+
+// Config 模板渲染配置
+// Env 为模板中允许读取的环境变量, 支持 filepath.Match 的通配符, 如 APP_*
+// 为空时模板不能读取环境变量, 避免密钥等敏感信息被写入配置文件
+type Config struct {
+	Env []string `json:"env"`
+}
+
+// Renderer 渲染 Metadata.Template 为 true 的配置内容
+// 模板使用 text/template 语法, 如 {{ .IP }}:{{ .Port }}、{{ env "APP_DC" }}
+type Renderer struct {
+	env []string
+}
+
+// New ...
+func New(config Config) *Renderer {
+	return &Renderer{env: config.Env}
+}
+
+// Render 渲染配置内容, 渲染后 Template 置为 false
+// 模板中引用不存在的字段或者未允许的环境变量时返回错误
+func (r *Renderer) Render(value *structs.ConfValue, facts Facts) error {
+	if !value.Metadata.Template {
+		return nil
+	}
+	tpl, err := template.New("config").Option("missingkey=error").Funcs(template.FuncMap{
+		"env": r.getenv,
+	}).Parse(value.Content)
+	if err != nil {
+		return fmt.Errorf("parse config template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, facts); err != nil {
+		return fmt.Errorf("render config template: %w", err)
+	}
+	value.Content = buf.String()
+	value.Metadata.Template = false
+	return nil
+}
+
+func (r *Renderer) getenv(name string) (string, error) {
+	if r != nil {
+		for _, pattern := range r.env {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return os.Getenv(name), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("env %s is not allowed, see plugin.confProxy.template.env", strings.TrimSpace(name))
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"os"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderer_Render(t *testing.T) {
+	facts := Facts{Hostname: "host-1", IP: "10.0.0.1", ZoneCode: "HB-WHYL", Port: "8023"}
+	renderer := New(Config{Env: []string{"APP_*"}})
+	os.Setenv("APP_DC", "wh")
+	defer os.Unsetenv("APP_DC")
+
+	value := structs.ConfValue{
+		Content:  `addr = "{{ .IP }}:{{ .Port }}"` + "\n" + `zone = "{{ .ZoneCode }}"` + "\n" + `dc = "{{ env "APP_DC" }}"`,
+		Metadata: structs.MetaData{Template: true},
+	}
+	assert.Nil(t, renderer.Render(&value, facts))
+	assert.Equal(t, "addr = \"10.0.0.1:8023\"\nzone = \"HB-WHYL\"\ndc = \"wh\"", value.Content)
+	assert.False(t, value.Metadata.Template)
+
+	// 非模板配置不渲染
+	value = structs.ConfValue{Content: "addr = {{ .IP }}"}
+	assert.Nil(t, renderer.Render(&value, facts))
+	assert.Equal(t, "addr = {{ .IP }}", value.Content)
+
+	// 未允许的环境变量以及不存在的字段
+	for _, content := range []string{`{{ env "HOME" }}`, `{{ .Unknown }}`, `{{ .IP `} {
+		value = structs.ConfValue{Content: content, Metadata: structs.MetaData{Template: true}}
+		assert.NotNil(t, renderer.Render(&value, facts))
+		assert.True(t, value.Metadata.Template)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// 支持校验的配置格式
+const (
+	FormatToml = "toml"
+	FormatYaml = "yaml"
+	FormatJSON = "json"
+)
+
+var yamlLineRegexp = regexp.MustCompile(`line (\d+)`)
+
+// ParseError 配置内容解析失败, Line/Column 从1开始, 为0时表示无法定位
+type ParseError struct {
+	Format string `json:"format"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Msg    string `json:"msg"`
+}
+
+// Error ...
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid %s content at line %d, column %d: %s", e.Format, e.Line, e.Column, e.Msg)
+}
+
+// NormalizeFormat 统一格式名称, 如 yml -> yaml
+func NormalizeFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "yml" {
+		return FormatYaml
+	}
+	return format
+}
+
+// Validate 按照 format 校验配置内容, 不支持的格式不做校验
+func Validate(format, content string) error {
+	switch NormalizeFormat(format) {
+	case FormatToml:
+		return validateToml(content)
+	case FormatYaml:
+		return validateYaml(content)
+	case FormatJSON:
+		return validateJSON(content)
+	}
+	return nil
+}
+
+func validateToml(content string) error {
+	var v map[string]interface{}
+	_, err := toml.Decode(content, &v)
+	if err == nil {
+		return nil
+	}
+	parseErr := &ParseError{Format: FormatToml, Msg: err.Error()}
+	var tomlErr toml.ParseError
+	if errors.As(err, &tomlErr) {
+		if tomlErr.Message != "" {
+			parseErr.Msg = tomlErr.Message
+		}
+		parseErr.Line, parseErr.Column = position(content, tomlErr.Position.Start)
+		if tomlErr.Position.Line > 0 {
+			parseErr.Line = tomlErr.Position.Line
+		}
+	}
+	return parseErr
+}
+
+func validateYaml(content string) error {
+	var v interface{}
+	err := yaml.Unmarshal([]byte(content), &v)
+	if err == nil {
+		return nil
+	}
+	parseErr := &ParseError{Format: FormatYaml, Msg: strings.Join(strings.Fields(strings.TrimPrefix(err.Error(), "yaml: ")), " ")}
+	// yaml 只提供行号
+	if match := yamlLineRegexp.FindStringSubmatch(err.Error()); len(match) == 2 {
+		parseErr.Line, _ = strconv.Atoi(match[1])
+	}
+	return parseErr
+}
+
+func validateJSON(content string) error {
+	var v interface{}
+	err := json.Unmarshal([]byte(content), &v)
+	if err == nil {
+		return nil
+	}
+	parseErr := &ParseError{Format: FormatJSON, Msg: err.Error()}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// Offset 为读取出错字符之后的偏移
+		parseErr.Line, parseErr.Column = position(content, int(syntaxErr.Offset)-1)
+	}
+	return parseErr
+}
+
+// position 根据字节偏移计算行号和列号
+func position(content string, offset int) (line, column int) {
+	if offset > len(content) {
+		offset = len(content)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	before := content[:offset]
+	line = strings.Count(before, "\n") + 1
+	column = offset - strings.LastIndex(before, "\n")
+	return line, column
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		line    int
+		column  int
+		valid   bool
+	}{
+		{name: "toml ok", format: "toml", content: "[app]\nname = \"demo\"\n", valid: true},
+		{name: "toml bad", format: "toml", content: "[app]\nname = \"a\"\nname = \"b\"\n", line: 3, column: 1},
+		{name: "yaml ok", format: "yml", content: "app:\n  name: demo\n", valid: true},
+		{name: "yaml bad", format: "yaml", content: "app: 1\napp: 2\n", line: 2},
+		{name: "json ok", format: "JSON", content: `{"a":1}`, valid: true},
+		{name: "json bad", format: "json", content: "{\n\"a\":1,\n}", line: 3, column: 1},
+		{name: "unknown format", format: "ini", content: "[[[", valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.format, tt.content)
+			if tt.valid {
+				assert.Nil(t, err)
+				return
+			}
+			parseErr, ok := err.(*ParseError)
+			assert.True(t, ok)
+			assert.Equal(t, tt.line, parseErr.Line)
+			if tt.column > 0 {
+				assert.Equal(t, tt.column, parseErr.Column)
+			}
+		})
+	}
+}
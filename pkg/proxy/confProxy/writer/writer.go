@@ -0,0 +1,386 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	// DefaultBackup 默认保留的历史版本数量
+	DefaultBackup = 5
+	// DefaultFileMode 新建配置文件的权限
+	DefaultFileMode os.FileMode = 0644
+)
+
+// 配置下线时对已写入文件的处理策略
+const (
+	// DeletePolicyKeep 保留文件
+	DeletePolicyKeep = "keep"
+	// DeletePolicyRemove 删除文件
+	DeletePolicyRemove = "remove"
+	// DeletePolicyArchive 保存为历史版本后删除文件, 可以通过 Rollback 恢复
+	DeletePolicyArchive = "archive"
+)
+
+var (
+	// ErrChecksum 写入的内容与配置中心发布的MD5不一致
+	ErrChecksum = errors.New("config checksum mismatch")
+	// ErrVersionNotFound ...
+	ErrVersionNotFound = errors.New("config version not found")
+	// ErrConflict 写入前文件内容已经被修改
+	ErrConflict = errors.New("config changed before write")
+
+	md5Regexp = regexp.MustCompile("^[0-9a-f]{32}$")
+)
+
+// Version 配置文件的一个历史版本
+type Version struct {
+	ID        string `json:"id"`        // 历史版本标识
+	MD5       string `json:"md5"`       // 文件内容MD5
+	Timestamp int64  `json:"timestamp"` // 备份时间
+	Size      int64  `json:"size"`
+}
+
+// Writer 配置文件写入: 原子写入、校验、保留历史版本和回滚
+type Writer struct {
+	backup       int
+	deletePolicy string
+	mu           sync.Mutex
+}
+
+// New ...
+func New(backup int) *Writer {
+	if backup < 0 {
+		backup = DefaultBackup
+	}
+	return &Writer{backup: backup}
+}
+
+// WithDeletePolicy 设置配置下线时的处理策略, 默认保留文件
+func (w *Writer) WithDeletePolicy(policy string) *Writer {
+	w.deletePolicy = policy
+	return w
+}
+
+// Delete 配置下线时按照处理策略删除配置文件, 文件被删除时 removed 为 true
+func (w *Writer) Delete(path string) (removed bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch w.deletePolicy {
+	case DeletePolicyRemove:
+	case DeletePolicyArchive:
+		if _, err := w.saveVersion(path); err != nil {
+			return false, err
+		}
+	case "", DeletePolicyKeep:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown delete policy: %s", w.deletePolicy)
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Write 原子写入配置文件, 内容没有变化时不写入, changed 为 false
+// checksum 为配置中心发布的MD5, 为空或者不是MD5格式时不做内容校验
+func (w *Writer) Write(path, content, checksum string) (changed bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	snap, err := w.write(path, content, checksum)
+	return snap != nil, err
+}
+
+// WriteIf 文件当前内容的MD5仍为 current 时才写入, current 为空表示文件不存在
+// 文件已被修改时返回 ErrConflict, 避免覆盖同时写入的新内容
+func (w *Writer) WriteIf(path, content, checksum, current string) (changed bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	old, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if current != "" {
+			return false, ErrConflict
+		}
+	case err != nil:
+		return false, err
+	case util.MD5(string(old)) != current:
+		return false, ErrConflict
+	}
+	snap, err := w.write(path, content, checksum)
+	return snap != nil, err
+}
+
+// WriteAll 将同一份配置写入多个文件, 返回内容有变化的文件
+// 任意一个文件写入失败时, 已写入的文件恢复为写入前的内容, 保证多个文件的内容一致
+func (w *Writer) WriteAll(paths []string, content, checksum string) (changed []string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	snaps := make([]*snapshot, 0, len(paths))
+	for _, path := range paths {
+		snap, err := w.write(path, content, checksum)
+		if err != nil {
+			for i := len(snaps) - 1; i >= 0; i-- {
+				if rr := w.undo(snaps[i]); rr != nil {
+					xlog.Error("confProxy writer restore error", xlog.String("path", snaps[i].path), xlog.String("err", rr.Error()))
+				}
+			}
+			return nil, fmt.Errorf("write %s: %w", path, err)
+		}
+		if snap != nil {
+			snaps = append(snaps, snap)
+		}
+	}
+	changed = make([]string, 0, len(snaps))
+	for _, snap := range snaps {
+		changed = append(changed, snap.path)
+	}
+	return changed, nil
+}
+
+// snapshot 文件写入前的状态, 用于撤销写入
+type snapshot struct {
+	path     string
+	backupID string // 写入前保存的历史版本, 不保留历史版本时为空
+	content  []byte // 写入前的内容, 文件不存在时为 nil
+	existed  bool
+}
+
+// write 写入单个文件, 内容没有变化时返回 nil
+func (w *Writer) write(path, content, checksum string) (*snapshot, error) {
+	expect := util.MD5(content)
+	if IsMD5(checksum) && checksum != expect {
+		return nil, fmt.Errorf("%w: expect %s, got %s", ErrChecksum, checksum, expect)
+	}
+	snap := &snapshot{path: path}
+	old, err := ioutil.ReadFile(path)
+	if err == nil {
+		if util.MD5(string(old)) == expect {
+			// 内容没有变化
+			return nil, nil
+		}
+		snap.content, snap.existed = old, true
+	}
+
+	if snap.backupID, err = w.backupFile(path); err != nil {
+		return nil, err
+	}
+	if err := w.writeAndVerify(path, content, expect); err != nil {
+		if snap.backupID != "" {
+			if rr := w.restore(path, snap.backupID); rr != nil {
+				xlog.Error("confProxy writer restore error", xlog.String("path", path), xlog.String("err", rr.Error()))
+			}
+		}
+		return nil, err
+	}
+	w.prune(path)
+	return snap, nil
+}
+
+// undo 撤销一次写入: 优先从历史版本恢复, 写入前文件不存在时删除文件
+func (w *Writer) undo(snap *snapshot) error {
+	if !snap.existed {
+		if err := os.Remove(snap.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if snap.backupID != "" {
+		if err := w.restore(snap.path, snap.backupID); err == nil {
+			return nil
+		}
+	}
+	perm := DefaultFileMode
+	if info, err := os.Stat(snap.path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return util.WriteFileAtomic(snap.path, string(snap.content), perm)
+}
+
+// Versions 返回配置文件的历史版本, 按时间倒序
+func (w *Writer) Versions(path string) ([]Version, error) {
+	files, err := ioutil.ReadDir(historyDir(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Version{}, nil
+		}
+		return nil, err
+	}
+	versions := make([]Version, 0, len(files))
+	for _, info := range files {
+		version, ok := parseVersion(info)
+		if !ok {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID > versions[j].ID
+	})
+	return versions, nil
+}
+
+// Rollback 将配置文件恢复到指定的历史版本, version 可以是版本ID或MD5, 为空时恢复到上一个版本
+// 回滚前的文件同样会被保留为历史版本
+func (w *Writer) Rollback(path, version string) (Version, error) {
+	versions, err := w.Versions(path)
+	if err != nil {
+		return Version{}, err
+	}
+	var target *Version
+	for i := range versions {
+		if version == "" || versions[i].ID == version || versions[i].MD5 == version {
+			target = &versions[i]
+			break
+		}
+	}
+	if target == nil {
+		return Version{}, ErrVersionNotFound
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	content, err := ioutil.ReadFile(filepath.Join(historyDir(path), target.ID))
+	if err != nil {
+		return Version{}, err
+	}
+	if _, err := w.backupFile(path); err != nil {
+		return Version{}, err
+	}
+	if err := w.writeAndVerify(path, string(content), target.MD5); err != nil {
+		return Version{}, err
+	}
+	w.prune(path)
+	return *target, nil
+}
+
+func (w *Writer) writeAndVerify(path, content, checksum string) error {
+	perm := DefaultFileMode
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := util.WriteFileAtomic(path, content, perm); err != nil {
+		return err
+	}
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if got := util.MD5(string(written)); got != checksum {
+		return fmt.Errorf("%w: expect %s, written %s", ErrChecksum, checksum, got)
+	}
+	return nil
+}
+
+// backupFile 写入前备份当前文件, 不保留历史版本时不备份
+func (w *Writer) backupFile(path string) (string, error) {
+	if w.backup == 0 {
+		return "", nil
+	}
+	return w.saveVersion(path)
+}
+
+// saveVersion 将当前文件保存为历史版本, 文件不存在时返回空
+func (w *Writer) saveVersion(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	id := fmt.Sprintf("%d_%s", time.Now().UnixNano(), util.MD5(string(content)))
+	if err := util.WriteFileAtomic(filepath.Join(historyDir(path), id), string(content), DefaultFileMode); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (w *Writer) restore(path, id string) error {
+	content, err := ioutil.ReadFile(filepath.Join(historyDir(path), id))
+	if err != nil {
+		return err
+	}
+	perm := DefaultFileMode
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return util.WriteFileAtomic(path, string(content), perm)
+}
+
+// prune 只保留最近的 backup 个历史版本
+func (w *Writer) prune(path string) {
+	versions, err := w.Versions(path)
+	if err != nil || len(versions) <= w.backup {
+		return
+	}
+	for _, version := range versions[w.backup:] {
+		if err := os.Remove(filepath.Join(historyDir(path), version.ID)); err != nil {
+			xlog.Error("confProxy writer prune error", xlog.String("path", path), xlog.String("err", err.Error()))
+		}
+	}
+}
+
+// historyDir 历史版本保存在配置文件同级的隐藏目录中
+func historyDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".history")
+}
+
+func parseVersion(info os.FileInfo) (Version, bool) {
+	if info.IsDir() {
+		return Version{}, false
+	}
+	arr := strings.SplitN(info.Name(), "_", 2)
+	if len(arr) != 2 || !IsMD5(arr[1]) {
+		return Version{}, false
+	}
+	nano, err := strconv.ParseInt(arr[0], 10, 64)
+	if err != nil {
+		return Version{}, false
+	}
+	return Version{
+		ID:        info.Name(),
+		MD5:       arr[1],
+		Timestamp: time.Unix(0, nano).Unix(),
+		Size:      info.Size(),
+	}, true
+}
+
+// IsMD5 ...
+func IsMD5(s string) bool {
+	return md5Regexp.MatchString(s)
+}
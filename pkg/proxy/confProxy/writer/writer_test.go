@@ -0,0 +1,142 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/douyu/juno-agent/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func readFile(t *testing.T, path string) string {
+	buf, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	return string(buf)
+}
+
+func TestWriter_WriteAndRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "config-dev.toml")
+	w := New(2)
+
+	for _, content := range []string{"a=1", "a=2", "a=3", "a=4"} {
+		changed, err := w.Write(path, content, util.MD5(content))
+		assert.Nil(t, err)
+		assert.True(t, changed)
+	}
+	assert.Equal(t, "a=4", readFile(t, path))
+
+	// 内容没有变化时不写入
+	changed, err := w.Write(path, "a=4", "")
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	versions, err := w.Versions(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, util.MD5("a=3"), versions[0].MD5)
+
+	// rollback to the previous version
+	version, err := w.Rollback(path, "")
+	assert.Nil(t, err)
+	assert.Equal(t, util.MD5("a=3"), version.MD5)
+	assert.Equal(t, "a=3", readFile(t, path))
+
+	_, err = w.Rollback(path, util.MD5("a=1"))
+	assert.Equal(t, ErrVersionNotFound, err)
+}
+
+func TestWriter_Checksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config-dev.toml")
+	w := New(DefaultBackup)
+	_, err := w.Write(path, "a=1", "v1")
+	assert.Nil(t, err)
+
+	_, err = w.Write(path, "a=2", util.MD5("a=3"))
+	assert.True(t, errors.Is(err, ErrChecksum))
+	assert.Equal(t, "a=1", readFile(t, path))
+}
+
+func TestWriter_WriteIf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config-dev.toml")
+	w := New(DefaultBackup)
+
+	_, err := w.WriteIf(path, "a=1", "", util.MD5("a=0"))
+	assert.True(t, errors.Is(err, ErrConflict))
+	changed, err := w.WriteIf(path, "a=1", "", "")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+
+	// 文件已被修改
+	_, err = w.WriteIf(path, "a=2", "", "")
+	assert.True(t, errors.Is(err, ErrConflict))
+	changed, err = w.WriteIf(path, "a=2", "", util.MD5("a=1"))
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "a=2", readFile(t, path))
+}
+
+func TestWriter_Delete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config-dev.toml")
+
+	w := New(DefaultBackup)
+	_, err := w.Write(path, "a=1", "")
+	assert.Nil(t, err)
+	removed, err := w.Delete(path)
+	assert.Nil(t, err)
+	assert.False(t, removed)
+	assert.Equal(t, "a=1", readFile(t, path))
+
+	w.WithDeletePolicy(DeletePolicyArchive)
+	removed, err = w.Delete(path)
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// 归档的文件可以回滚恢复
+	_, err = w.Rollback(path, util.MD5("a=1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a=1", readFile(t, path))
+}
+
+func TestWriter_WriteAll(t *testing.T) {
+	dir := t.TempDir()
+	exist := filepath.Join(dir, "exist.toml")
+	created := filepath.Join(dir, "created.toml")
+	// 父路径是文件, 写入失败
+	blocked := filepath.Join(exist, "blocked.toml")
+
+	for _, backup := range []int{0, DefaultBackup} {
+		w := New(backup)
+		assert.Nil(t, ioutil.WriteFile(exist, []byte("a=1"), DefaultFileMode))
+
+		_, err := w.WriteAll([]string{exist, created, blocked}, "a=2", "")
+		assert.NotNil(t, err)
+		// 已写入的文件恢复为写入前的状态
+		assert.Equal(t, "a=1", readFile(t, exist))
+		_, err = os.Stat(created)
+		assert.True(t, os.IsNotExist(err))
+
+		changed, err := w.WriteAll([]string{exist, created}, "a=2", "")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{exist, created}, changed)
+		assert.Nil(t, os.Remove(created))
+	}
+}
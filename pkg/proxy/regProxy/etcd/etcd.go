@@ -18,9 +18,10 @@ import (
 	"container/list"
 	"errors"
 
+	"github.com/douyu/juno-agent/pkg/proxy/watcher"
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/douyu/jupiter/pkg/client/etcdv3"
-	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
 )
 
 var (
@@ -33,8 +34,12 @@ type DataSource struct {
 	etcdClient *etcdv3.Client
 	prefix     string
 	// 用于记录长轮训的应用信息
-	jm    list.List // *job
-	zones []string
+	jm       list.List // *job
+	zones    []string
+	watchers []*watcher.Watcher
+	// 已写入文件的key, 用于全量加载时删除已下线的文件
+	prometheusKeys *watcher.KeySet
+	governKeys     map[string]*watcher.KeySet // hostKey -> keys
 }
 
 // configNode etcd node chan info
@@ -46,8 +51,10 @@ type configNode struct {
 // NewETCDDataSource ...
 func NewETCDDataSource(prometheusTargetGenConfig PluginRegProxyPrometheus) *DataSource {
 	dataSource := &DataSource{
-		etcdClient: etcdv3.StdConfig("register").MustBuild(),
-		zones:      prometheusTargetGenConfig.Zones,
+		etcdClient:     etcdv3.StdConfig("register").MustBuild(),
+		zones:          prometheusTargetGenConfig.Zones,
+		prometheusKeys: watcher.NewKeySet(),
+		governKeys:     make(map[string]*watcher.KeySet),
 	}
 
 	if !prometheusTargetGenConfig.Enable {
@@ -58,15 +65,11 @@ func NewETCDDataSource(prometheusTargetGenConfig PluginRegProxyPrometheus) *Data
 	}
 
 	if prometheusTargetGenConfig.EnableZone {
-		dataSource.GovernConfigScanner(prometheusTargetGenConfig.Path, prometheusTargetGenConfig.Prefixs)
-		xgo.Go(func() {
-			dataSource.watchGovern(prometheusTargetGenConfig.Path, prometheusTargetGenConfig.Prefixs)
-		})
+		revisions := dataSource.GovernConfigScanner(prometheusTargetGenConfig.Path, prometheusTargetGenConfig.Prefixs)
+		dataSource.watchGovern(prometheusTargetGenConfig.Path, prometheusTargetGenConfig.Prefixs, revisions)
 	} else {
-		dataSource.PrometheusConfigScanner(prometheusTargetGenConfig.Path)
-		xgo.Go(func() {
-			dataSource.watchPrometheus(prometheusTargetGenConfig.Path)
-		})
+		revision := dataSource.PrometheusConfigScanner(prometheusTargetGenConfig.Path)
+		dataSource.watchPrometheus(prometheusTargetGenConfig.Path, revision)
 		if prometheusTargetGenConfig.EnableCleanup {
 			dataSource.cleanup(prometheusTargetGenConfig.Path, prometheusTargetGenConfig.TimeInterval)
 		}
@@ -79,3 +82,23 @@ func NewETCDDataSource(prometheusTargetGenConfig PluginRegProxyPrometheus) *Data
 func (d *DataSource) GetClient() *etcdv3.Client {
 	return d.etcdClient
 }
+
+// Healthy prometheus/govern 的监听是否都正常
+func (d *DataSource) Healthy() bool {
+	for _, w := range d.watchers {
+		if !w.Status().Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// Stop 停止所有监听并关闭etcd客户端
+func (d *DataSource) Stop() {
+	for _, w := range d.watchers {
+		w.Stop()
+	}
+	if err := d.etcdClient.Close(); err != nil {
+		xlog.Error("regProxy close etcd client", xlog.FieldErr(err))
+	}
+}
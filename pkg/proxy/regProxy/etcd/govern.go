@@ -3,6 +3,7 @@ package etcd
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/fs"
 	"os"
 	"path"
@@ -10,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/douyu/juno-agent/pkg/proxy/watcher"
 	"github.com/douyu/juno-agent/util"
 	"github.com/douyu/jupiter/pkg/xlog"
 	"go.etcd.io/etcd/api/v3/mvccpb"
@@ -123,90 +125,114 @@ func getFileName(govern *governValue) string {
 	}
 	return govern.AppName + "_" + govern.Hostname
 }
-func (d *DataSource) watchGovern(path string, prefixs []string) {
+
+// watchGovern 从每个前缀加载时的revision之后开始监听, 断开后从最后处理的revision继续, revision被压缩时全量加载该前缀
+func (d *DataSource) watchGovern(path string, prefixs []string, revisions map[string]int64) {
 	// etcd的key用作配置数据读取
 	hostKeys := governPrefixs
 	if len(prefixs) > 0 {
 		hostKeys = prefixs
 	}
-	for _, hostKey := range hostKeys {
-		// init watch
-		watch, err := d.etcdClient.WatchPrefix(context.Background(), hostKey)
-		if err != nil {
-			panic("watch err: " + err.Error())
+	for _, tmpHostKey := range hostKeys {
+		hostKey := tmpHostKey
+		handler := func(event *clientv3.Event) {
+			d.handleGovern(path, hostKey, event)
 		}
-		go func() {
-			for {
-				select {
-				case event := <-watch.C():
-					switch event.Type {
-					case mvccpb.DELETE:
-						key := string(event.Kv.Key)
-						govern := d.parseGovernKey(key)
-
-						if govern == nil {
-							continue
-						}
-
-						filename := getFileName(govern)
-						_ = os.Remove(path + "/" + filename + ".yml")
-						_ = os.Remove(path + "/" + "pyroscope/" + filename + ".yml")
-					case mvccpb.PUT:
-						key, value := string(event.Kv.Key), string(event.Kv.Value)
-						govern := d.parseGovern(key, value)
-
-						if d.filter(govern) == nil {
-							continue
-						}
-
-						err = d.writeFile(path, govern)
-						if err != nil {
-							xlog.Error("writeFile error", xlog.FieldErr(err))
-							continue
-						}
-					}
-				}
-			}
-		}()
+		rescan := func() (int64, error) {
+			return d.scanGovern(path, hostKey)
+		}
+		w := watcher.New(d.etcdClient.Client, hostKey, handler).WithRescan(rescan)
+		w.Start(revisions[hostKey])
+		d.watchers = append(d.watchers, w)
 	}
+}
+
+func (d *DataSource) handleGovern(path, hostKey string, event *clientv3.Event) {
+	switch event.Type {
+	case mvccpb.DELETE:
+		key := string(event.Kv.Key)
+		d.governKeys[hostKey].Remove(key)
+		d.removeGovernFile(path, key)
+	case mvccpb.PUT:
+		key, value := string(event.Kv.Key), string(event.Kv.Value)
+		govern := d.parseGovern(key, value)
 
+		if d.filter(govern) == nil {
+			return
+		}
+
+		if err := d.writeFile(path, govern); err != nil {
+			xlog.Error("writeFile error", xlog.FieldErr(err))
+			return
+		}
+		d.governKeys[hostKey].Add(key)
+	}
 }
 
-// GovernConfigScanner ..
-func (d *DataSource) GovernConfigScanner(path string, prefixs []string) {
-	// etcd的key用作配置数据读取
+// removeGovernFile 删除实例key对应的文件
+func (d *DataSource) removeGovernFile(path, key string) {
+	govern := d.parseGovernKey(key)
+
+	if govern == nil {
+		return
+	}
+
+	filename := getFileName(govern)
+	_ = os.Remove(path + "/" + filename + ".yml")
+	_ = os.Remove(path + "/" + "pyroscope/" + filename + ".yml")
+}
+
+// GovernConfigScanner .. 返回每个前缀加载时的revision, 加载失败的前缀不返回
+func (d *DataSource) GovernConfigScanner(path string, prefixs []string) map[string]int64 {
 	// etcd的key用作配置数据读取
 	hostKeys := governPrefixs
 	if len(prefixs) > 0 {
 		hostKeys = prefixs
 	}
-	for _, tmpHostKey := range hostKeys {
-		hostKey := tmpHostKey
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-		defer cancel()
-		resp, err := d.etcdClient.Get(ctx, hostKey, clientv3.WithPrefix())
+	revisions := make(map[string]int64, len(hostKeys))
+	xlog.Info("GovernConfigScanner begin")
+	for _, hostKey := range hostKeys {
+		// 监听开始前创建, 之后只读
+		if _, ok := d.governKeys[hostKey]; !ok {
+			d.governKeys[hostKey] = watcher.NewKeySet()
+		}
+		revision, err := d.scanGovern(path, hostKey)
 		if err != nil {
 			xlog.Error("etcdClient.Get error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("hostKey", hostKey))
-			return
+			continue
 		}
+		revisions[hostKey] = revision
+	}
+	return revisions
+}
 
-		xlog.Info("GovernConfigScanner begin")
-
-		for _, kv := range resp.Kvs {
-
-			key, value := string(kv.Key), string(kv.Value)
-			govern := d.parseGovern(key, value)
-			if d.filter(govern) == nil {
-				continue
-			}
+// scanGovern 加载一个前缀下的全部实例, 返回加载时的revision
+func (d *DataSource) scanGovern(path, hostKey string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := d.etcdClient.Get(ctx, hostKey, clientv3.WithPrefix())
+	if err != nil {
+		return 0, fmt.Errorf("get %s: %w", hostKey, err)
+	}
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key, value := string(kv.Key), string(kv.Value)
+		govern := d.parseGovern(key, value)
+		if d.filter(govern) == nil {
+			continue
+		}
 
-			err = d.writeFile(path, govern)
-			if err != nil {
-				xlog.Error("writeFile error", xlog.FieldErr(err))
-				continue
-			}
+		if err := d.writeFile(path, govern); err != nil {
+			xlog.Error("writeFile error", xlog.FieldErr(err))
+			continue
 		}
+		keys = append(keys, key)
+	}
+	// 监听中断期间下线的实例没有删除事件, 与上一次加载的结果比较后删除文件
+	for _, key := range d.governKeys[hostKey].Reset(keys) {
+		d.removeGovernFile(path, key)
 	}
+	return resp.Header.Revision, nil
 }
 
 // cleanup clean invalid prometheus yml
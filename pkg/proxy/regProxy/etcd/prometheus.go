@@ -2,77 +2,69 @@ package etcd
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/douyu/juno-agent/pkg/proxy/watcher"
 	"github.com/douyu/juno-agent/util"
 	"github.com/douyu/jupiter/pkg/xlog"
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-func (d *DataSource) watchPrometheus(path string) {
-	// etcd的key用作配置数据读取
-	hostKey := strings.Join([]string{"/prometheus", "job"}, "/")
-	// init watch
-	watch, err := d.etcdClient.WatchPrefix(context.Background(), hostKey)
+// prometheusPrefix etcd的key用作配置数据读取
+var prometheusPrefix = strings.Join([]string{"/prometheus", "job"}, "/")
 
-	if err != nil {
-		panic("watch err: " + err.Error())
+// watchPrometheus 从 revision 之后开始监听, 断开后从最后处理的revision继续, revision被压缩时全量加载
+func (d *DataSource) watchPrometheus(path string, revision int64) {
+	handler := func(event *clientv3.Event) {
+		d.handlePrometheus(path, event)
+	}
+	rescan := func() (int64, error) {
+		return d.scanPrometheus(path)
 	}
-	go func() {
-		for {
-			select {
-			case event := <-watch.C():
-				switch event.Type {
-				case mvccpb.DELETE:
-					key := string(event.Kv.Key)
-					keyArr := strings.Split(key, "/")
-					if len(keyArr) != 5 && len(keyArr) != 6 {
-						xlog.Error("watchPrometheus", xlog.String("key", key))
-						break
-					}
+	w := watcher.New(d.etcdClient.Client, prometheusPrefix, handler).WithRescan(rescan)
+	w.Start(revision)
+	d.watchers = append(d.watchers, w)
+}
 
-					filename := keyArr[3] + "_" + keyArr[4]
-					filePath := path + "/" + filename + ".yml"
-					err = os.Remove(filePath)
-					if err != nil {
-						xlog.Error("remove prometheus file error", xlog.FieldErr(err))
-					}
-				case mvccpb.PUT:
-					key, value := string(event.Kv.Key), string(event.Kv.Value)
-					keyArr := strings.Split(key, "/")
-					if len(keyArr) != 5 && len(keyArr) != 6 {
-						xlog.Error("watchPrometheus", xlog.String("key", key), xlog.String("value", value))
-						break
-					}
-					filename := keyArr[3] + "_" + keyArr[4]
-					content := `
-- targets:
-    - "` + value + `"
-  labels:
-    instance: ` + keyArr[4] + `
-    job: ` + keyArr[3]
-					_ = util.WriteFile(path+"/"+filename+".yml", content)
-				}
-			}
+func (d *DataSource) handlePrometheus(path string, event *clientv3.Event) {
+	switch event.Type {
+	case mvccpb.DELETE:
+		key := string(event.Kv.Key)
+		d.prometheusKeys.Remove(key)
+		removePrometheusFile(path, key)
+	case mvccpb.PUT:
+		key, value := string(event.Kv.Key), string(event.Kv.Value)
+		keyArr := strings.Split(key, "/")
+		if len(keyArr) != 5 && len(keyArr) != 6 {
+			xlog.Error("watchPrometheus", xlog.String("key", key), xlog.String("value", value))
+			break
 		}
-	}()
+		d.prometheusKeys.Add(key)
+		_ = writePrometheusFile(path, keyArr, value)
+	}
 }
 
-// PrometheusConfigScanner ..
-func (d *DataSource) PrometheusConfigScanner(path string) {
-	// etcd的key用作配置数据读取
-	hostKey := strings.Join([]string{"/prometheus", "job"}, "/")
+// PrometheusConfigScanner .. 返回加载时的revision, 加载失败时为0
+func (d *DataSource) PrometheusConfigScanner(path string) int64 {
+	revision, err := d.scanPrometheus(path)
+	if err != nil {
+		xlog.Error("init get hostKey error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("hostKey", prometheusPrefix))
+	}
+	return revision
+}
 
+func (d *DataSource) scanPrometheus(path string) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
-	resp, err := d.etcdClient.Get(ctx, hostKey, clientv3.WithPrefix())
+	resp, err := d.etcdClient.Get(ctx, prometheusPrefix, clientv3.WithPrefix())
 	if err != nil {
-		xlog.Error("init get hostKey error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("hostKey", hostKey))
-		return
+		return 0, fmt.Errorf("get %s: %w", prometheusPrefix, err)
 	}
+	keys := make([]string, 0, len(resp.Kvs))
 	for _, kv := range resp.Kvs {
 		key, value := string(kv.Key), string(kv.Value)
 		keyArr := strings.Split(key, "/")
@@ -80,15 +72,39 @@ func (d *DataSource) PrometheusConfigScanner(path string) {
 			xlog.Error("PrometheusConfigScanner", xlog.String("key", key), xlog.String("value", value))
 			continue
 		}
-		filename := keyArr[3] + "_" + keyArr[4]
+		keys = append(keys, key)
+		_ = writePrometheusFile(path, keyArr, value)
+	}
+	// 监听中断期间删除的key没有事件, 与上一次加载的结果比较后删除文件
+	for _, key := range d.prometheusKeys.Reset(keys) {
+		removePrometheusFile(path, key)
+	}
+	return resp.Header.Revision, nil
+}
 
-		content := `
+// removePrometheusFile 删除key对应的文件
+func removePrometheusFile(path, key string) {
+	keyArr := strings.Split(key, "/")
+	if len(keyArr) != 5 && len(keyArr) != 6 {
+		xlog.Error("watchPrometheus", xlog.String("key", key))
+		return
+	}
+
+	filename := keyArr[3] + "_" + keyArr[4]
+	filePath := path + "/" + filename + ".yml"
+	err := os.Remove(filePath)
+	if err != nil {
+		xlog.Error("remove prometheus file error", xlog.FieldErr(err))
+	}
+}
+
+func writePrometheusFile(path string, keyArr []string, value string) error {
+	filename := keyArr[3] + "_" + keyArr[4]
+	content := `
 - targets:
     - "` + value + `"
   labels:
     instance: ` + keyArr[4] + `
     job: ` + keyArr[3]
-		_ = util.WriteFile(path+"/"+filename+".yml", content)
-	}
-	return
+	return util.WriteFile(path+"/"+filename+".yml", content)
 }
@@ -41,7 +41,9 @@ type RegProxy struct {
 	pb.WatchServer
 
 	*etcdv3.Client
-	nodeChan chan *structs.ServiceNode
+	dataSource *etcd.DataSource
+	nodeChan   chan *structs.ServiceNode
+	closeOnce  sync.Once
 
 	serviceConfigurations sync.Map
 	helloworld.GreeterServer
@@ -50,8 +52,9 @@ type RegProxy struct {
 // NewRegProxy ...
 func NewRegProxy(confClient *etcd.DataSource) *RegProxy {
 	proxy := &RegProxy{
-		Client:   confClient.GetClient(),
-		nodeChan: make(chan *structs.ServiceNode, 100),
+		Client:     confClient.GetClient(),
+		dataSource: confClient,
+		nodeChan:   make(chan *structs.ServiceNode, 100),
 	}
 	return proxy
 }
@@ -72,9 +75,17 @@ func (proxy *RegProxy) Start() error {
 	return nil
 }
 
-// Close ...
+// Close 停止prometheus/govern监听并关闭etcd客户端
 func (proxy *RegProxy) Close() {
-	close(proxy.nodeChan)
+	proxy.closeOnce.Do(func() {
+		proxy.dataSource.Stop()
+		close(proxy.nodeChan)
+	})
+}
+
+// Healthy ...
+func (proxy *RegProxy) Healthy() bool {
+	return proxy.dataSource.Healthy()
 }
 
 // C ...
@@ -0,0 +1,65 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watcher
+
+import (
+	"sort"
+	"sync"
+)
+
+// KeySet 记录前缀下已经处理的key, 全量加载时找出监听中断期间被删除的key
+// 全量加载只能返回存在的key, 被删除的key需要和上一次的结果比较得出
+type KeySet struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// NewKeySet ...
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]struct{})}
+}
+
+// Add 监听到新增或修改的key
+func (s *KeySet) Add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = struct{}{}
+}
+
+// Remove 监听到删除的key
+func (s *KeySet) Remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+}
+
+// Reset 用全量加载的key替换, 返回之前存在但本次加载中已经不存在的key
+func (s *KeySet) Reset(keys []string) []string {
+	current := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		current[key] = struct{}{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := make([]string, 0)
+	for key := range s.keys {
+		if _, ok := current[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	s.keys = current
+	sort.Strings(removed)
+	return removed
+}
@@ -0,0 +1,278 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/jupiter/pkg/xlog"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// minBackoff 监听断开后第一次重连的等待时间
+	minBackoff = time.Millisecond * 500
+	// maxBackoff 重连的最长等待时间
+	maxBackoff = time.Second * 30
+)
+
+// ErrClosed 监听在未停止时被etcd关闭
+var ErrClosed = errors.New("etcd watch channel closed")
+
+// Handler 处理监听到的事件, 返回后该事件的revision视为已处理
+type Handler func(event *clientv3.Event)
+
+// Rescan 全量加载前缀下的数据, 返回加载时的revision
+type Rescan func() (int64, error)
+
+// compactedError 需要继续监听的revision已被压缩
+type compactedError struct {
+	revision int64
+}
+
+func (e *compactedError) Error() string {
+	return fmt.Sprintf("required revision has been compacted, compact revision %d", e.revision)
+}
+
+// Watcher 监听etcd前缀, 停止后可以从最后处理的revision继续监听
+type Watcher struct {
+	client  *clientv3.Client
+	prefix  string
+	handler Handler
+	rescan  Rescan
+	prevKV  bool
+
+	// 保证同一时间只有一个监听
+	lifecycle sync.Mutex
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	mu     sync.Mutex
+	status structs.WatchStatus
+}
+
+// New 创建后需要调用 Start 开始监听
+func New(client *clientv3.Client, prefix string, handler Handler) *Watcher {
+	return &Watcher{
+		client:  client,
+		prefix:  prefix,
+		handler: handler,
+		status:  structs.WatchStatus{Prefix: prefix},
+	}
+}
+
+// WithRescan 最后处理的revision被压缩后, 通过全量加载恢复, 从加载时的revision继续监听
+// 未设置时从压缩后最早的revision继续, 被压缩的变化会丢失
+// 设置后没有处理过的revision时(如启动时的全量加载失败), 同样先全量加载再监听
+func (w *Watcher) WithRescan(rescan Rescan) *Watcher {
+	w.rescan = rescan
+	return w
+}
+
+// WithPrevKV 事件中包含变化前的数据, 删除事件可以通过 event.PrevKv 获取删除前的value
+func (w *Watcher) WithPrevKV() *Watcher {
+	w.prevKV = true
+	return w
+}
+
+// Start 监听 revision 之后的变化, 已经在监听时先停止
+// revision 为0时从最后处理的revision继续, 没有处理过事件时先全量加载, 未设置全量加载时从当前开始
+func (w *Watcher) Start(revision int64) {
+	w.lifecycle.Lock()
+	defer w.lifecycle.Unlock()
+	w.stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel, w.done = cancel, make(chan struct{})
+	w.mu.Lock()
+	if revision > 0 {
+		w.status.Revision = revision
+	}
+	w.status.Healthy = true
+	w.status.StartedAt = time.Now().Unix()
+	w.mu.Unlock()
+	go w.run(ctx, w.done)
+}
+
+// Stop 停止监听, 等待正在处理的事件完成
+func (w *Watcher) Stop() {
+	w.lifecycle.Lock()
+	defer w.lifecycle.Unlock()
+	w.stop()
+}
+
+// Revision 最后处理的revision
+func (w *Watcher) Revision() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status.Revision
+}
+
+// Status ...
+func (w *Watcher) Status() structs.WatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *Watcher) stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+	w.cancel, w.done = nil, nil
+	w.mu.Lock()
+	w.status.Healthy = false
+	w.mu.Unlock()
+}
+
+// run 监听断开后从最后处理的revision重连, 直到停止
+func (w *Watcher) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	backoff := minBackoff
+	for {
+		var (
+			connected bool
+			err       error
+		)
+		if w.rescan != nil && w.Revision() == 0 {
+			// 启动时的全量加载失败, 连接成功后先全量加载, 否则失败期间已有的数据不会被处理
+			if err = w.load(); err != nil {
+				err = fmt.Errorf("initial rescan: %w", err)
+			}
+		} else {
+			connected, err = w.watch(ctx)
+			var compacted *compactedError
+			if errors.As(err, &compacted) {
+				err = w.recover(compacted.revision)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			backoff = minBackoff
+			continue
+		}
+		w.fail(err)
+		if connected {
+			backoff = minBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// watch 从最后处理的revision之后开始监听, 返回监听是否建立成功以及断开的原因
+func (w *Watcher) watch(ctx context.Context) (bool, error) {
+	opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithCreatedNotify()}
+	if revision := w.Revision(); revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision+1))
+	}
+	if w.prevKV {
+		opts = append(opts, clientv3.WithPrevKV())
+	}
+	connected := false
+	// 没有leader时关闭监听, 由重连切换到其他节点
+	for resp := range w.client.Watch(clientv3.WithRequireLeader(ctx), w.prefix, opts...) {
+		if resp.CompactRevision > 0 {
+			return connected, &compactedError{revision: resp.CompactRevision}
+		}
+		if err := resp.Err(); err != nil {
+			return connected, err
+		}
+		if resp.Created {
+			connected = true
+			w.connected()
+		}
+		for _, event := range resp.Events {
+			w.handler(event)
+			w.processed(event.Kv.ModRevision)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return connected, err
+	}
+	return connected, ErrClosed
+}
+
+// recover revision被压缩后全量加载, 从加载时的revision继续
+func (w *Watcher) recover(compactRevision int64) error {
+	xlog.Warn("etcd watch revision compacted", xlog.String("prefix", w.prefix), xlog.Int64("revision", w.Revision()),
+		xlog.Int64("compactRevision", compactRevision))
+	if w.rescan == nil {
+		w.mu.Lock()
+		w.status.Revision = compactRevision - 1
+		w.mu.Unlock()
+		return nil
+	}
+	if err := w.load(); err != nil {
+		return fmt.Errorf("rescan after compaction: %w", err)
+	}
+	return nil
+}
+
+// load 全量加载, 从加载时的revision继续监听
+func (w *Watcher) load() error {
+	revision, err := w.rescan()
+	if err != nil {
+		return err
+	}
+	if revision <= 0 {
+		return errors.New("rescan returned no revision")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.Revision = revision
+	w.status.Rescans++
+	return nil
+}
+
+func (w *Watcher) connected() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.Healthy = true
+}
+
+func (w *Watcher) processed(revision int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if revision > w.status.Revision {
+		w.status.Revision = revision
+	}
+	w.status.Healthy = true
+	w.status.LastEventAt = time.Now().Unix()
+}
+
+func (w *Watcher) fail(err error) {
+	xlog.Error("etcd watch error", xlog.String("prefix", w.prefix), xlog.String("err", err.Error()))
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.Healthy = false
+	w.status.LastError = err.Error()
+	w.status.LastErrorAt = time.Now().Unix()
+}
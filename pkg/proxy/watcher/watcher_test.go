@@ -0,0 +1,198 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watcher
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// startEtcd 启动内嵌的etcd
+func startEtcd(t *testing.T) (*clientv3.Client, func()) {
+	dir, err := ioutil.TempDir("", "watcher")
+	assert.Nil(t, err)
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	clientURL, _ := url.Parse("http://127.0.0.1:0")
+	peerURL, _ := url.Parse("http://127.0.0.1:0")
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.Name + "=" + peerURL.String()
+	server, err := embed.StartEtcd(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	<-server.Server.ReadyNotify()
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{server.Clients[0].Addr().String()}, DialTimeout: time.Second * 5})
+	assert.Nil(t, err)
+	return client, func() {
+		client.Close()
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// recorder 记录处理过的key
+type recorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (r *recorder) handle(event *clientv3.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, string(event.Kv.Key))
+}
+
+func (r *recorder) wait(t *testing.T, n int) []string {
+	for i := 0; i < 100; i++ {
+		r.mu.Lock()
+		keys := append([]string(nil), r.keys...)
+		r.mu.Unlock()
+		if len(keys) >= n {
+			return keys
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Fatalf("wait %d events timeout", n)
+	return nil
+}
+
+func TestWatcher_Resume(t *testing.T) {
+	client, stop := startEtcd(t)
+	defer stop()
+	ctx := context.Background()
+
+	r := &recorder{}
+	w := New(client, "/watcher", r.handle)
+	w.Start(0)
+	_, err := client.Put(ctx, "/watcher/a", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/watcher/a"}, r.wait(t, 1))
+	status := w.Status()
+	assert.True(t, status.Healthy)
+	assert.True(t, status.Revision > 0)
+
+	// 停止期间的变化在重新监听后处理
+	w.Stop()
+	assert.False(t, w.Status().Healthy)
+	_, err = client.Put(ctx, "/watcher/b", "1")
+	assert.Nil(t, err)
+	_, err = client.Put(ctx, "/other/c", "1")
+	assert.Nil(t, err)
+	w.Start(0)
+	// 重复启动只保留一个监听
+	w.Start(0)
+	_, err = client.Put(ctx, "/watcher/d", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/watcher/a", "/watcher/b", "/watcher/d"}, r.wait(t, 3))
+	time.Sleep(time.Millisecond * 100)
+	assert.Len(t, r.wait(t, 3), 3)
+	w.Stop()
+}
+
+func TestWatcher_Compacted(t *testing.T) {
+	client, stop := startEtcd(t)
+	defer stop()
+	ctx := context.Background()
+
+	r := &recorder{}
+	rescans := 0
+	w := New(client, "/watcher", r.handle).WithRescan(func() (int64, error) {
+		rescans++
+		resp, err := client.Get(ctx, "/watcher", clientv3.WithPrefix())
+		if err != nil {
+			return 0, err
+		}
+		for _, kv := range resp.Kvs {
+			r.handle(&clientv3.Event{Kv: kv})
+		}
+		return resp.Header.Revision, nil
+	})
+	w.Start(0)
+	_, err := client.Put(ctx, "/watcher/a", "1")
+	assert.Nil(t, err)
+	r.wait(t, 1)
+	w.Stop()
+
+	// 停止期间的变化被压缩, 重新监听时全量加载
+	_, err = client.Put(ctx, "/watcher/b", "1")
+	assert.Nil(t, err)
+	resp, err := client.Put(ctx, "/watcher/b", "2")
+	assert.Nil(t, err)
+	_, err = client.Compact(ctx, resp.Header.Revision)
+	assert.Nil(t, err)
+	w.Start(0)
+	assert.Equal(t, []string{"/watcher/a", "/watcher/a", "/watcher/b"}, r.wait(t, 3))
+
+	_, err = client.Put(ctx, "/watcher/c", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "/watcher/c", r.wait(t, 4)[3])
+	// 启动时没有处理过的revision, 同样全量加载一次
+	status := w.Status()
+	assert.Equal(t, 2, status.Rescans)
+	assert.Equal(t, 2, rescans)
+	assert.True(t, status.Healthy)
+	w.Stop()
+}
+
+func TestWatcher_InitialRescan(t *testing.T) {
+	client, stop := startEtcd(t)
+	defer stop()
+	ctx := context.Background()
+
+	// 启动前已经存在的数据, 启动时的全量加载失败
+	_, err := client.Put(ctx, "/watcher/a", "1")
+	assert.Nil(t, err)
+	r := &recorder{}
+	w := New(client, "/watcher", r.handle).WithRescan(func() (int64, error) {
+		resp, err := client.Get(ctx, "/watcher", clientv3.WithPrefix())
+		if err != nil {
+			return 0, err
+		}
+		for _, kv := range resp.Kvs {
+			r.handle(&clientv3.Event{Kv: kv})
+		}
+		return resp.Header.Revision, nil
+	})
+	w.Start(0)
+	assert.Equal(t, []string{"/watcher/a"}, r.wait(t, 1))
+	_, err = client.Put(ctx, "/watcher/b", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/watcher/a", "/watcher/b"}, r.wait(t, 2))
+	assert.Equal(t, 1, w.Status().Rescans)
+	w.Stop()
+}
+
+func TestKeySet_Reset(t *testing.T) {
+	s := NewKeySet()
+	assert.Empty(t, s.Reset([]string{"/a", "/b"}))
+	s.Add("/c")
+	s.Remove("/a")
+	s.Add("/d")
+	// 监听中断期间 /b /d 被删除
+	assert.Equal(t, []string{"/b", "/d"}, s.Reset([]string{"/c", "/e"}))
+	assert.Empty(t, s.Reset([]string{"/c", "/e"}))
+}
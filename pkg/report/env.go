@@ -26,6 +26,9 @@ var (
 	appIP = GetIP()
 	// HostName machine hostname
 	hostName = GetHostName("")
+	// region/zone 由 Build 从环境变量中读取
+	regionCode, regionName string
+	zoneCode, zoneName     string
 )
 
 // GetHostName ...
@@ -56,3 +59,13 @@ func ReturnHostName() string {
 func ReturnAppIp() string {
 	return appIP
 }
+
+// ReturnRegion 返回 region code 与 name, 需要先 Build
+func ReturnRegion() (code, name string) {
+	return regionCode, regionName
+}
+
+// ReturnZone 返回 zone code 与 name, 需要先 Build
+func ReturnZone() (code, name string) {
+	return zoneCode, zoneName
+}
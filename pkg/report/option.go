@@ -67,6 +67,8 @@ func (r *Config) Build() *Report {
 	r.ZoneName = os.Getenv(r.ZoneName)
 	r.HostName = GetHostName(r.HostName)
 	hostName = r.HostName
+	regionCode, regionName = r.RegionCode, r.RegionName
+	zoneCode, zoneName = r.ZoneCode, r.ZoneName
 	env := os.Getenv(r.Env)
 	if env == "" {
 		env = "dev"
@@ -75,6 +77,7 @@ func (r *Config) Build() *Report {
 	report := &Report{
 		config:   r,
 		Reporter: NewHTTPReport(r),
+		stop:     make(chan struct{}),
 	}
 	if r.Enable {
 		xlog.Info("plugin", xlog.String("reportAgentStatus", "start"))
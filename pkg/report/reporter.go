@@ -15,6 +15,7 @@
 package report
 
 import (
+	"sync"
 	"time"
 
 	"github.com/douyu/juno-agent/pkg/model"
@@ -37,6 +38,16 @@ type Reporter interface {
 type Report struct {
 	config *Config
 	Reporter
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	mu       sync.RWMutex
+	lastErr  string
+}
+
+// Enabled ...
+func (r *Report) Enabled() bool {
+	return r.config.Enable
 }
 
 // ReportAgentStatus report agent status
@@ -44,23 +55,59 @@ func (r *Report) ReportAgentStatus() error {
 	if !r.config.Enable {
 		return nil
 	}
+	interval := r.config.Internal
+	if interval <= 0 {
+		interval = DefaultConfig().Internal
+	}
 	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 		for {
-			req := model.AgentReportRequest{
-				Hostname:     r.config.HostName,
-				IP:           appIP,
-				AgentType:    1,
-				VCSInfo:      pkg.AppVersion(),
-				AgentVersion: "0.2.1",
-				RegionCode:   r.config.RegionCode,
-				RegionName:   r.config.RegionName,
-				ZoneCode:     r.config.ZoneCode,
-				ZoneName:     r.config.ZoneName,
-				Env:          r.config.Env,
+			r.report()
+			select {
+			case <-ticker.C:
+			case <-r.stop:
+				return
 			}
-			r.Reporter.Report(req)
-			time.Sleep(time.Duration(r.config.Internal))
 		}
 	}()
 	return nil
 }
+
+// Stop 停止上报
+func (r *Report) Stop() {
+	r.stopOnce.Do(func() {
+		if r.stop != nil {
+			close(r.stop)
+		}
+	})
+}
+
+// LastError 最近一次上报的错误, 成功时为空
+func (r *Report) LastError() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastErr
+}
+
+func (r *Report) report() {
+	req := model.AgentReportRequest{
+		Hostname:     r.config.HostName,
+		IP:           appIP,
+		AgentType:    1,
+		VCSInfo:      pkg.AppVersion(),
+		AgentVersion: "0.2.1",
+		RegionCode:   r.config.RegionCode,
+		RegionName:   r.config.RegionName,
+		ZoneCode:     r.config.ZoneCode,
+		ZoneName:     r.config.ZoneName,
+		Env:          r.config.Env,
+	}
+	resp := r.Reporter.Report(req)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastErr = ""
+	if resp.Err != 0 {
+		r.lastErr = resp.Msg
+	}
+}
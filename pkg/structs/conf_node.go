@@ -29,12 +29,24 @@ type ConfNode struct {
 	Port          string            `json:"port" toml:"port"`                   // 应用部署机器port
 	FileName      string            `json:"file_name" toml:"file_name"`         // 应用部署配置文件名称
 	Configuration *AppConfiguration `json:"configuration" toml:"configuration"` // 应用部署配置具体信息
+	Deleted       bool              `json:"deleted" toml:"deleted"`             // 配置已下线
 }
 
 // ContentNode ...
 type ContentNode struct {
-	Content string `json:"content"` // 应用部署配置内容
-	Version int64  `json:"version"` // 应用部署配置版本
+	Content   string `json:"content"`   // 应用部署配置内容
+	Version   string `json:"version"`   // 应用部署配置版本, 即配置中心发布的 Metadata.Version
+	Format    string `json:"format"`    // 配置格式: toml/yaml/json
+	Scope     string `json:"scope"`     // 生效配置的范围: host/zone:<code>/region:<code>/cluster
+	Timestamp int64  `json:"timestamp"` // 配置发布时间
+	Stale     bool   `json:"stale"`     // 配置中心不可用时, 数据来自本地缓存
+	Deleted   bool   `json:"deleted"`   // 配置已在配置中心下线
+}
+
+// ConfEvent 推送给订阅者的配置变化, Key 为订阅时的配置key
+type ConfEvent struct {
+	Key string `json:"key"`
+	ContentNode
 }
 
 // ConfKey 存储配置的key字段 for instance
@@ -68,21 +80,23 @@ func (c *ConfKey) CheckValid() error {
 	return nil
 }
 
-// ParserConfKey parse conf key
+// ParserConfKey parse conf key: /<prefix>/<hostname>/<app>/<env>/static/<file>/<port>
+// prefix 可以包含多级目录, 如 /fleet-a/juno-agent
 func ParserConfKey(key string) (keyData ConfKey, err error) {
 	arr := strings.Split(key, "/")
-	if len(arr) != 8 {
+	if len(arr) < 8 {
 		err = fmt.Errorf("key invaild")
 		return
 	}
+	arr = append([]string{strings.Join(arr[1:len(arr)-6], "/")}, arr[len(arr)-6:]...)
 	keyData = ConfKey{
-		Prefix:   arr[1],
-		Hostname: arr[2],
-		AppName:  arr[3],
-		EnvName:  arr[4],
-		Rest:     arr[5],
-		FileName: arr[6],
-		Port:     arr[7],
+		Prefix:   arr[0],
+		Hostname: arr[1],
+		AppName:  arr[2],
+		EnvName:  arr[3],
+		Rest:     arr[4],
+		FileName: arr[5],
+		Port:     arr[6],
 	}
 	return
 }
@@ -91,6 +105,8 @@ func ParserConfKey(key string) (keyData ConfKey, err error) {
 type ConfValue struct {
 	Content  string   `json:"content"`
 	Metadata MetaData `json:"metadata"`
+	// Scope 配置所在的范围, 由数据源查询时根据key设置
+	Scope string `json:"-"`
 }
 
 // MetaData ...
@@ -99,6 +115,9 @@ type MetaData struct {
 	Version   string   `json:"version"`
 	Format    string   `json:"format"`
 	Paths     []string `json:"paths"`
+	Encoded   bool     `json:"encoded"`  // content是否加密
+	KeyID     string   `json:"key_id"`   // 加密使用的密钥id, 为空时使用默认密钥
+	Template  bool     `json:"template"` // content是否为模板, 写入前使用主机信息渲染
 }
 
 // CheckValid ...
@@ -118,6 +137,33 @@ func (c *ConfValue) CheckValid() error {
 	return nil
 }
 
+// ConfNode 根据配置的key生成配置节点
+func (c *ConfValue) ConfNode(key ConfKey) *ConfNode {
+	return &ConfNode{
+		AppName:  key.AppName,
+		AppEnvi:  key.EnvName,
+		IP:       "",
+		FileName: key.FileName,
+		Port:     key.Port,
+		Configuration: &AppConfiguration{
+			Content:  c.Content,
+			Scope:    key.Hostname,
+			Metadata: Metadata{Format: c.Metadata.Format, Timestamp: c.Metadata.Timestamp, Version: c.Metadata.Version},
+		},
+	}
+}
+
+// ContentNode ...
+func (c *ConfValue) ContentNode() ContentNode {
+	return ContentNode{
+		Content:   c.Content,
+		Version:   c.Metadata.Version,
+		Format:    c.Metadata.Format,
+		Scope:     c.Scope,
+		Timestamp: c.Metadata.Timestamp,
+	}
+}
+
 // ParserConfValue ...
 func ParserConfValue(value string) (valueData ConfValue, err error) {
 	if err = json.Unmarshal([]byte(value), &valueData); err != nil {
@@ -126,15 +172,167 @@ func ParserConfValue(value string) (valueData ConfValue, err error) {
 	return
 }
 
-// ConfReport {"file_name":"config-live.toml","md5":"0f07572ba1212a75d8b5a0167c5507c2","hostname":"xxx.live.unp","env":"live","timestamp":1560477493}
+// 配置下发状态
+const (
+	// ConfStatusApplied 配置已写入
+	ConfStatusApplied = "applied"
+	// ConfStatusWriteFailed 配置文件写入失败
+	ConfStatusWriteFailed = "write-failed"
+	// ConfStatusValidationFailed 配置key/value校验失败
+	ConfStatusValidationFailed = "validation-failed"
+	// ConfStatusDecryptFailed 加密的配置内容解密失败
+	ConfStatusDecryptFailed = "decrypt-failed"
+	// ConfStatusRenderFailed 配置模板渲染失败
+	ConfStatusRenderFailed = "render-failed"
+	// ConfStatusEnvSkipped 配置环境不在agent处理范围内
+	ConfStatusEnvSkipped = "env-skipped"
+	// ConfStatusDeleted 配置已下线
+	ConfStatusDeleted = "deleted"
+	// ConfStatusNotCached 下线的配置不在本地缓存中, 无法确定需要处理的文件
+	ConfStatusNotCached = "not-cached"
+	// ConfStatusDrifted 配置文件被手动修改或删除, 与最后一次下发的内容不一致
+	ConfStatusDrifted = "drifted"
+	// ConfStatusHealed 配置文件不一致, 已恢复为最后一次下发的内容
+	ConfStatusHealed = "healed"
+)
+
+// ErrEnvPass 配置的环境不在agent处理范围内
+var ErrEnvPass = errors.New("env pass")
+
+// EnvFilter agent处理的配置环境, 为空时处理全部环境
+type EnvFilter []string
+
+// Check 环境不在范围内时返回 ErrEnvPass
+func (f EnvFilter) Check(env string) error {
+	if len(f) == 0 {
+		return nil
+	}
+	for _, item := range f {
+		if item == env {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrEnvPass, env)
+}
+
+// Filter 返回环境在范围内的配置节点
+func (f EnvFilter) Filter(nodes []*ConfNode) []*ConfNode {
+	res := nodes[:0]
+	for _, node := range nodes {
+		if f.Check(node.AppEnvi) == nil {
+			res = append(res, node)
+		}
+	}
+	return res
+}
+
+// ConfApplyError 配置下发失败, Status 为失败时的下发状态
+type ConfApplyError struct {
+	Status string
+	Err    error
+}
+
+// NewConfApplyError ...
+func NewConfApplyError(status string, err error) *ConfApplyError {
+	return &ConfApplyError{Status: status, Err: err}
+}
+
+// Error ...
+func (e *ConfApplyError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap ...
+func (e *ConfApplyError) Unwrap() error {
+	return e.Err
+}
+
+// ConfApplyStatus 根据下发的错误返回下发状态
+func ConfApplyStatus(err error) string {
+	if err == nil {
+		return ConfStatusApplied
+	}
+	var applyErr *ConfApplyError
+	if errors.As(err, &applyErr) {
+		return applyErr.Status
+	}
+	return ConfStatusWriteFailed
+}
+
+// ConfHookResult 配置写入后对使用该配置的程序执行动作的结果
+type ConfHookResult struct {
+	Path    string `json:"path"`    // 配置文件路径
+	Manager string `json:"manager"` // systemd|supervisor
+	Program string `json:"program"` // 程序名称
+	Action  string `json:"action"`  // signal/reload/restart/http
+	Success bool   `json:"success"`
+	Output  string `json:"output"`
+	Error   string `json:"error"`
+}
+
+// ConfApply 配置下发结果
+type ConfApply struct {
+	Paths   []string         // 已写入的配置文件, 配置下线时为已删除的文件
+	Changed []string         // 内容有变化的配置文件, 需要对使用的程序执行动作
+	Hooks   []ConfHookResult // 写入后执行的动作, 动作异步执行, 完成后再次上报
+	Deleted bool             // 配置已下线
+}
+
+// ConfReport {"file_name":"config-live.toml","md5":"0f07572ba1212a75d8b5a0167c5507c2","hostname":"xxx.live.unp","env":"live","timestamp":1560477493,"status":"applied"}
 type ConfReport struct {
-	FileName   string `json:"file_name"`
-	MD5        string `json:"md5"`
-	Hostname   string `json:"hostname"`
-	Env        string `json:"env"`
-	Timestamp  int64  `json:"timestamp"`
-	IP         string `json:"ip"`
-	HealthPort string `json:"health_port"`
+	FileName   string           `json:"file_name"`
+	MD5        string           `json:"md5"` // 配置中心发布的版本
+	Hostname   string           `json:"hostname"`
+	Env        string           `json:"env"`
+	Timestamp  int64            `json:"timestamp"`
+	IP         string           `json:"ip"`
+	HealthPort string           `json:"health_port"`
+	Status     string           `json:"status"`   // 下发状态: applied/write-failed/validation-failed/decrypt-failed/env-skipped/deleted/drifted/healed
+	Error      string           `json:"error"`    // 下发失败的原因
+	Paths      []string         `json:"paths"`    // 已写入的配置文件
+	Checksum   string           `json:"checksum"` // 写入后磁盘上文件内容的MD5
+	Line       int              `json:"line"`     // 配置内容解析失败的行号
+	Column     int              `json:"column"`   // 配置内容解析失败的列号
+	Hooks      []ConfHookResult `json:"hooks"`    // 配置写入后执行动作的结果
+}
+
+// ConfDrift 配置文件与最后一次下发的内容不一致
+type ConfDrift struct {
+	Key        string `json:"key"`         // 配置key
+	Path       string `json:"path"`        // 配置文件路径
+	Version    string `json:"version"`     // 最后一次下发的 Metadata.Version
+	Expected   string `json:"expected"`    // 最后一次下发内容的MD5
+	Actual     string `json:"actual"`      // 磁盘上文件内容的MD5, 文件不存在时为空
+	Missing    bool   `json:"missing"`     // 文件已被删除
+	Healed     bool   `json:"healed"`      // 已恢复为下发的内容
+	Error      string `json:"error"`       // 读取或恢复失败的原因
+	DetectedAt int64  `json:"detected_at"` // 发现不一致的时间
+}
+
+// 配置下发审计记录的触发来源
+const (
+	ConfTriggerScanner  = "scanner"  // 启动时全量加载
+	ConfTriggerWatch    = "watch"    // 监听到配置变化
+	ConfTriggerReload   = "reload"   // 重新加载
+	ConfTriggerRescan   = "rescan"   // 监听的revision被压缩后全量加载
+	ConfTriggerRollback = "rollback" // 手动回滚到历史版本
+	ConfTriggerHeal     = "heal"     // 漂移检查恢复
+)
+
+// ConfAudit 配置下发审计记录
+type ConfAudit struct {
+	Timestamp   int64    `json:"timestamp"`
+	Trigger     string   `json:"trigger"` // scanner/watch/reload/rescan/rollback/heal
+	Key         string   `json:"key"`
+	App         string   `json:"app"`
+	Env         string   `json:"env"`
+	File        string   `json:"file"`
+	Port        string   `json:"port"`
+	Version     string   `json:"version"`      // 本次下发的 Metadata.Version
+	PrevVersion string   `json:"prev_version"` // 上一次下发成功的 Metadata.Version
+	Paths       []string `json:"paths"`
+	Status      string   `json:"status"` // 同 ConfReport.Status
+	Error       string   `json:"error"`
 }
 
 // JSONString json
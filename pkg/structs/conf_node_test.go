@@ -0,0 +1,50 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParserConfKey(t *testing.T) {
+	key, err := ParserConfKey("/juno-agent/host1/app1/dev/static/config-dev.toml/9999")
+	assert.Nil(t, err)
+	assert.Equal(t, ConfKey{Prefix: "juno-agent", Hostname: "host1", AppName: "app1", EnvName: "dev", Rest: "static", FileName: "config-dev.toml", Port: "9999"}, key)
+
+	// 多级前缀
+	key, err = ParserConfKey("/fleet-a/juno-agent/host1/app1/dev/static/config-dev.toml/9999")
+	assert.Nil(t, err)
+	assert.Equal(t, "fleet-a/juno-agent", key.Prefix)
+	assert.Equal(t, "host1", key.Hostname)
+
+	_, err = ParserConfKey("/juno-agent/cluster/app1/dev/static/config-dev.toml")
+	assert.NotNil(t, err)
+}
+
+func TestEnvFilter(t *testing.T) {
+	assert.Nil(t, EnvFilter(nil).Check("test"))
+
+	filter := EnvFilter{"dev", "live"}
+	assert.Nil(t, filter.Check("dev"))
+	err := filter.Check("pre")
+	assert.True(t, errors.Is(err, ErrEnvPass))
+	assert.Equal(t, ConfStatusEnvSkipped, ConfApplyStatus(NewConfApplyError(ConfStatusEnvSkipped, err)))
+
+	nodes := filter.Filter([]*ConfNode{{AppEnvi: "dev"}, {AppEnvi: "pre"}, {AppEnvi: "live"}})
+	assert.Len(t, nodes, 2)
+}
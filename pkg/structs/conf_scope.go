@@ -0,0 +1,119 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 配置下发的范围, 对应配置key中hostname的位置: /prefix/<scope>/<app>/<env>/static/<file>[/<port>]
+const (
+	// ScopeCluster 按应用下发
+	ScopeCluster = "cluster"
+	// scopeRegionPrefix 按region下发, 如 region:WUHAN
+	scopeRegionPrefix = "region:"
+	// scopeZonePrefix 按zone下发, 如 zone:HB-WHYL
+	scopeZonePrefix = "zone:"
+)
+
+// 范围的优先级
+const (
+	rankCluster = iota
+	rankRegion
+	rankZone
+	rankHost
+)
+
+// RegionScope 返回region范围
+func RegionScope(regionCode string) string {
+	return scopeRegionPrefix + regionCode
+}
+
+// ZoneScope 返回zone范围
+func ZoneScope(zoneCode string) string {
+	return scopeZonePrefix + zoneCode
+}
+
+// ConfScopes 返回本机配置的范围, 按优先级从低到高排列, zoneCode/regionCode 为空时不使用该范围
+func ConfScopes(hostname, zoneCode, regionCode string) []string {
+	scopes := []string{ScopeCluster}
+	if regionCode != "" {
+		scopes = append(scopes, RegionScope(regionCode))
+	}
+	if zoneCode != "" {
+		scopes = append(scopes, ZoneScope(zoneCode))
+	}
+	return append(scopes, hostname)
+}
+
+// ScopeRank 返回范围的优先级, cluster < region < zone < host
+func ScopeRank(scope string) int {
+	switch {
+	case scope == ScopeCluster:
+		return rankCluster
+	case strings.HasPrefix(scope, scopeRegionPrefix):
+		return rankRegion
+	case strings.HasPrefix(scope, scopeZonePrefix):
+		return rankZone
+	}
+	return rankHost
+}
+
+// ScopePrefix 返回应用在某个范围下的配置key前缀
+func ScopePrefix(prefix, scope, appName, appEnv string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/static/", prefix, scope, appName, appEnv)
+}
+
+// ScopeKey 返回应用配置在某个范围下的key, 只有host范围的key包含端口
+func ScopeKey(prefix, scope, appName, appEnv, target, port string) string {
+	key := ScopePrefix(prefix, scope, appName, appEnv) + target
+	if ScopeRank(scope) == rankHost {
+		key += "/" + port
+	}
+	return key
+}
+
+// ConfLayer 某个范围下发的一个配置文件, 只有host范围的配置有端口
+type ConfLayer struct {
+	Scope    string
+	AppName  string
+	EnvName  string
+	FileName string
+	Port     string
+	Value    ConfValue
+}
+
+// ParserConfLayer 解析配置key中的范围、应用、环境、文件名以及端口, key 需要在 prefix 下
+func ParserConfLayer(prefix, key string) (ConfLayer, error) {
+	if !strings.HasPrefix(key, prefix+"/") {
+		return ConfLayer{}, fmt.Errorf("key %s is not under prefix %s", key, prefix)
+	}
+	arr := strings.Split(strings.TrimPrefix(key, prefix+"/"), "/")
+	if len(arr) < 5 || len(arr) > 6 || arr[3] != "static" {
+		return ConfLayer{}, fmt.Errorf("key invaild")
+	}
+	layer := ConfLayer{Scope: arr[0], AppName: arr[1], EnvName: arr[2], FileName: arr[4]}
+	if len(arr) == 6 {
+		layer.Port = arr[5]
+	}
+	return layer, nil
+}
+
+// ConfBundleFile 应用的一个配置文件, Scopes 为生效的范围, 按优先级从低到高排列
+type ConfBundleFile struct {
+	ContentNode
+	Scopes []string `json:"scopes"`
+}
@@ -34,6 +34,7 @@ type ProgramExt struct {
 	RestartSec   int      `json:"restart_sec" toml:"restart_sec"`   // start interval
 	ConfData     string   `json:"conf_data" toml:"conf_data"`       // configuration data
 	Config       string   `json:"config" toml:"config"`             // profile name used for specific configuration
+	ExecReload   string   `json:"exec_reload" toml:"exec_reload"`   // systemd reload command
 }
 
 // UUID the unique uuid of program
@@ -68,6 +68,18 @@ type AppConfiguration struct {
 	Content   string     `json:"content"`
 	Resources []Resource `json:"resources"`
 	Metadata  Metadata   `json:"metadata"`
+	Scope     string     `json:"scope"` // 配置所在的范围
+}
+
+// ContentNode ...
+func (a *AppConfiguration) ContentNode() ContentNode {
+	return ContentNode{
+		Content:   a.Content,
+		Version:   a.Metadata.Version,
+		Format:    a.Metadata.Format,
+		Scope:     a.Scope,
+		Timestamp: a.Metadata.Timestamp,
+	}
 }
 
 // Metadata ...
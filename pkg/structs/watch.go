@@ -0,0 +1,37 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structs
+
+// WatchStatus 数据源监听状态
+type WatchStatus struct {
+	Prefix      string `json:"prefix"`
+	Revision    int64  `json:"revision"` // 最后处理的etcd revision, mysql数据源为已处理的最大version
+	Healthy     bool   `json:"healthy"`
+	StartedAt   int64  `json:"started_at"`
+	LastEventAt int64  `json:"last_event_at"`
+	LastError   string `json:"last_error"`
+	LastErrorAt int64  `json:"last_error_at"`
+	Rescans     int    `json:"rescans"` // revision被压缩后全量加载的次数
+}
+
+// ConfReloadStatus 配置数据源重新加载的状态
+type ConfReloadStatus struct {
+	DataSource      string      `json:"datasource"`
+	Watch           WatchStatus `json:"watch"`
+	Reloading       bool        `json:"reloading"`
+	Reloads         int         `json:"reloads"` // 启动后重新加载的次数
+	LastReloadAt    int64       `json:"last_reload_at"`
+	LastReloadError string      `json:"last_reload_error"`
+}
@@ -28,11 +28,28 @@ const DefaultConfig = `
         prefix = "/juno-agent"
         timeout="3s"
         enable = true
+        backup = 5 # 配置文件保留的历史版本数量
+        deletePolicy = "keep" # 配置下线时对已写入文件的处理: keep/remove/archive
         #配置中心数据源
-        [pugin.confProxy.mysql]
+        [plugin.confProxy.mysql]
             enable=false
             dsn=""
             secure=false
+            table="juno_agent_config"
+            pollInterval="5s"
+        [plugin.confProxy.encrypt] # 加密配置的AES密钥, 以env:开头时从环境变量读取
+            default=""
+            [plugin.confProxy.encrypt.keys]
+        [plugin.confProxy.drift] # 检查已写入的配置文件是否被修改
+            enable=false
+            interval="1m"
+            heal=false
+        [plugin.confProxy.audit] # 配置下发审计记录, 单个文件大小单位为MB
+            enable=true
+            maxSize=10
+            maxBackups=5
+        [plugin.confProxy.template] # 模板配置中允许读取的环境变量
+            env=[]
         [plugin.confProxy.etcd]
             enable=true
             endpoints=["127.0.0.1:2379"]
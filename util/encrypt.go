@@ -50,7 +50,10 @@ func AESCBCEncrypt(orig string, key string) (string, error) {
 
 func AESCBCDecrypt(cryted string, key string) (string, error) {
 	// 转成字节数组
-	crytedByte, _ := base64.StdEncoding.DecodeString(cryted)
+	crytedByte, err := base64.StdEncoding.DecodeString(cryted)
+	if err != nil {
+		return "", fmt.Errorf("密文base64解码失败: %w", err)
+	}
 	k := []byte(key)
 	if len(k) != 32 {
 		return "", fmt.Errorf("密钥长度需要为32")
@@ -58,9 +61,17 @@ func AESCBCDecrypt(cryted string, key string) (string, error) {
 
 	block, _ := aes.NewCipher(k)
 	blockSize := block.BlockSize()
+	if len(crytedByte) == 0 || len(crytedByte)%blockSize != 0 {
+		return "", fmt.Errorf("密文长度错误")
+	}
 	blockMode := cipher.NewCBCDecrypter(block, k[:blockSize])
 	orig := make([]byte, len(crytedByte))
 	blockMode.CryptBlocks(orig, crytedByte)
+	// 密钥错误时补码校验失败
+	unpadding := int(orig[len(orig)-1])
+	if unpadding == 0 || unpadding > blockSize || !bytes.Equal(orig[len(orig)-unpadding:], bytes.Repeat([]byte{byte(unpadding)}, unpadding)) {
+		return "", fmt.Errorf("密文补码错误, 请检查密钥")
+	}
 	orig = PKCS7UnPadding(orig)
 	return string(orig), nil
 }
@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 )
 
 func ReadDirFiles(dir string, appName string) (result map[string]string, err error) {
@@ -75,6 +76,46 @@ func WriteFile(filePath string, content string) error {
 	return nil
 }
 
+// WriteFileAtomic 先写临时文件并fsync, 再rename覆盖目标文件, 避免进程崩溃时留下写了一半的文件
+func WriteFileAtomic(filePath string, content string, perm os.FileMode) (err error) {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.WriteString(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filePath); err != nil {
+		return err
+	}
+	// rename 之后同步目录, 保证目录项落盘
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
+
 // 生成32位MD5
 func MD5(text string) string {
 	ctx := md5.New()
@@ -0,0 +1,38 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignal(t *testing.T) {
+	for name, want := range map[string]syscall.Signal{"": syscall.SIGHUP, "SIGTERM": syscall.SIGTERM, "hup": syscall.SIGHUP, "10": syscall.Signal(10)} {
+		sig, err := ParseSignal(name, syscall.SIGHUP)
+		assert.Nil(t, err)
+		assert.Equal(t, want, sig)
+	}
+	_, err := ParseSignal("foo", syscall.SIGHUP)
+	assert.NotNil(t, err)
+}
+
+func TestSignalName(t *testing.T) {
+	assert.Equal(t, "SIGTERM", SignalName(syscall.SIGTERM))
+	// 未知的信号不输出为数字
+	assert.Equal(t, "signal 200", SignalName(syscall.Signal(200)))
+}